@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// apiHistoryRetention is how long API usage samples are kept: one 7-day window and a day
+const apiHistoryRetention = 8 * 24 * time.Hour
+
+// APIUsageSample is one fetched API usage, as recorded in the history file
+type APIUsageSample struct {
+	Time   int64              `json:"ts"`
+	Limits map[string]float64 `json:"limits"` // Bucket name -> utilization percent
+}
+
+// apiHistoryPath returns the API usage history file
+func apiHistoryPath() string {
+	return filepath.Join(sessionTrackerDir(), "api-usage-history.jsonl")
+}
+
+// readAPIHistory reads the recorded API usage samples, oldest first
+func readAPIHistory() []APIUsageSample {
+	file, err := os.Open(apiHistoryPath())
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var samples []APIUsageSample
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var sample APIUsageSample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err == nil {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// recordAPIUsage appends a fetched usage to the history, drops samples past
+// retention, and returns the history including the new sample. Callers hold
+// the API usage refresh lock.
+func recordAPIUsage(usage APIUsage, now time.Time) []APIUsageSample {
+	sample := APIUsageSample{Time: now.Unix(), Limits: make(map[string]float64, len(usage.Limits))}
+	for name, limit := range usage.Limits {
+		sample.Limits[name] = limit.Utilization
+	}
+
+	cutoff := now.Add(-apiHistoryRetention).Unix()
+	var samples []APIUsageSample
+	var buf bytes.Buffer
+	for _, s := range append(readAPIHistory(), sample) {
+		if s.Time < cutoff {
+			continue
+		}
+		if data, err := json.Marshal(s); err == nil {
+			buf.Write(data)
+			buf.WriteByte('\n')
+			samples = append(samples, s)
+		}
+	}
+	writeFileAtomic(apiHistoryPath(), buf.Bytes(), 0644)
+	return samples
+}
+
+// forecastWindow returns how far back a bucket's slope is measured and the
+// shortest stretch of samples a forecast is made from
+func forecastWindow(name string) (lookback, minSpan time.Duration) {
+	if strings.HasPrefix(name, "five_hour") {
+		return time.Hour, 10 * time.Minute
+	}
+	return 24 * time.Hour, 2 * time.Hour
+}
+
+// projectExhaustion extrapolates a bucket's utilization over the lookback
+// window to the time it reaches 100%. Samples before the last drop in
+// utilization belong to a previous window and are ignored. It returns the zero
+// time when usage is not rising, there are too few samples, or the window
+// resets first.
+func projectExhaustion(samples []APIUsageSample, name string, limit APILimit) time.Time {
+	lookback, minSpan := forecastWindow(name)
+
+	var points []APIUsageSample
+	for _, sample := range samples {
+		value, ok := sample.Limits[name]
+		if !ok {
+			continue
+		}
+		if n := len(points); n > 0 && value < points[n-1].Limits[name] {
+			points = points[:0] // Window reset
+		}
+		points = append(points, sample)
+	}
+	if len(points) < 2 {
+		return time.Time{}
+	}
+
+	last := points[len(points)-1]
+	first := points[0]
+	for _, p := range points {
+		if p.Time >= last.Time-int64(lookback.Seconds()) {
+			first = p
+			break
+		}
+	}
+
+	span := last.Time - first.Time
+	rise := last.Limits[name] - first.Limits[name]
+	if span < int64(minSpan.Seconds()) || rise <= 0 {
+		return time.Time{}
+	}
+	if last.Limits[name] >= 100 {
+		return time.Unix(last.Time, 0)
+	}
+
+	seconds := (100 - last.Limits[name]) * float64(span) / rise
+	exhaust := time.Unix(last.Time, 0).Add(time.Duration(seconds * float64(time.Second)))
+	if reset, ok := parseLimitTime(limit.ResetsAt); ok && !exhaust.Before(reset) {
+		return time.Time{}
+	}
+	return exhaust
+}
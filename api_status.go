@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kevinlincg/claude-statusline/themes"
+)
+
+// APIError is a failed API usage fetch, classified by the status it shows as
+type APIError struct {
+	Status  string // A themes.APIStatus* value
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// apiErrorStatus returns the display status of a fetch error
+func apiErrorStatus(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status
+	}
+	return themes.APIStatusError
+}
+
+// httpStatusError classifies an unsuccessful HTTP status code; it returns nil for 200
+func httpStatusError(code int) error {
+	switch {
+	case code == http.StatusOK:
+		return nil
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return &APIError{Status: themes.APIStatusUnauthenticated, Message: fmt.Sprintf("HTTP %d: OAuth token rejected", code)}
+	case code == http.StatusTooManyRequests:
+		return &APIError{Status: themes.APIStatusRateLimited, Message: "HTTP 429: rate limited"}
+	case code >= 500:
+		return &APIError{Status: themes.APIStatusOffline, Message: fmt.Sprintf("HTTP %d: server error", code)}
+	}
+	return &APIError{Status: themes.APIStatusError, Message: fmt.Sprintf("HTTP %d", code)}
+}
+
+// APIUsageState is the cached API usage as shown by the themes
+type APIUsageState struct {
+	Usage  *APIUsage     // Nil until a fetch has succeeded
+	Status string        // A themes.APIStatus* value; empty before the first refresh
+	Age    time.Duration // Time since Usage was fetched
+}
+
+// state derives the display status: the error of the last refresh attempt if it
+// failed, stale if the data is over twice the TTL old, ok otherwise
+func (c APIUsageCache) state(ttl time.Duration, now time.Time) APIUsageState {
+	var state APIUsageState
+	if !c.CachedAt.IsZero() {
+		state.Usage = &c.Usage
+		state.Age = now.Sub(c.CachedAt)
+	}
+
+	switch {
+	case c.Status != "" && c.Status != themes.APIStatusOK:
+		state.Status = c.Status
+	case state.Usage == nil:
+		// Not fetched yet
+	case state.Age > 2*ttl:
+		state.Status = themes.APIStatusStale
+	default:
+		state.Status = themes.APIStatusOK
+	}
+	return state
+}
+
+// runDoctor handles --doctor: it reports the API usage setup, the cached state
+// and the result of a live fetch
+func runDoctor() {
+	config := loadConfig()
+	row := func(label, value string) {
+		fmt.Printf("%-14s %s\n", label+":", value)
+	}
+	formatTime := func(t time.Time) string {
+		return fmt.Sprintf("%s (%s ago)", t.Local().Format("2006-01-02 15:04:05"), themes.FormatDuration(time.Since(t).Round(time.Second)))
+	}
+
+	configPath := getConfigPath()
+	if _, err := os.Stat(configPath); err != nil {
+		configPath += " (not found, using defaults)"
+	}
+	row("Config", configPath)
+
+	usageAPI := config.UsageAPI
+	if usageAPI == "" {
+		usageAPI = "oauth_usage"
+	}
+	baseURL, err := config.apiBaseURL()
+	if err != nil {
+		row("Usage API", usageAPI+", "+err.Error())
+	} else {
+		row("Usage API", usageAPI+" via "+baseURL)
+	}
+
+	// The default transport honors HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+	proxy := "none"
+	if req, err := http.NewRequest("GET", baseURL, nil); baseURL != "" && err == nil {
+		if proxyURL, err := http.ProxyFromEnvironment(req); err != nil {
+			proxy = "invalid: " + err.Error()
+		} else if proxyURL != nil {
+			proxyURL.User = nil // Don't print credentials
+			proxy = proxyURL.String()
+		}
+	}
+	row("Proxy", proxy)
+
+	token := "found"
+	if getOAuthToken() == "" {
+		token = "missing (log in to Claude Code)"
+	}
+	row("OAuth token", token)
+	row("Cache TTL", config.apiCacheTTL().String())
+
+	fmt.Println()
+	if cached, ok := readAPIUsageCache(); ok {
+		state := cached.state(config.apiCacheTTL(), time.Now())
+		row("Cache", apiUsageCachePath())
+		status := state.Status
+		if status == "" {
+			status = "not fetched yet"
+		}
+		row("Status", status)
+		if !cached.CachedAt.IsZero() {
+			row("Fetched", formatTime(cached.CachedAt))
+		}
+		if !cached.CheckedAt.IsZero() {
+			row("Last attempt", formatTime(cached.CheckedAt))
+		}
+		if cached.LastError != "" {
+			row("Last error", fmt.Sprintf("%s, %s", cached.LastError, formatTime(cached.LastErrorAt)))
+		} else {
+			row("Last error", "none")
+		}
+	} else {
+		row("Cache", apiUsageCachePath()+" (missing)")
+	}
+
+	fmt.Println()
+	usage, err := fetchUsage(config)
+	if err != nil {
+		row("Live check", fmt.Sprintf("%s: %v", apiErrorStatus(err), err))
+		os.Exit(1)
+	}
+	names := make([]string, 0, len(usage.Limits))
+	for name := range usage.Limits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	limits := make([]string, 0, len(names))
+	for _, name := range names {
+		limits = append(limits, fmt.Sprintf("%s %.0f%%", name, usage.Limits[name].Utilization))
+	}
+	row("Live check", "ok: "+strings.Join(limits, ", "))
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kevinlincg/claude-statusline/themes"
+)
+
+// Budget is a set of spend limits in USD; zero means no limit
+type Budget struct {
+	Daily   float64 `json:"daily,omitempty"`
+	Weekly  float64 `json:"weekly,omitempty"`
+	Monthly float64 `json:"monthly,omitempty"`
+}
+
+// BudgetConfig holds the global and per-project budgets and their alerts
+type BudgetConfig struct {
+	Budget
+	Projects   map[string]Budget `json:"projects,omitempty"`   // Project path (~ allowed) -> budget
+	Thresholds []int             `json:"thresholds,omitempty"` // Alert percentages, default 80 and 100
+	Hook       string            `json:"hook,omitempty"`       // Shell command run when a threshold is first crossed
+}
+
+// defaultBudgetThresholds are the alert percentages used when none are configured
+var defaultBudgetThresholds = []int{80, 100}
+
+// thresholds returns the configured alert percentages in ascending order
+func (c BudgetConfig) thresholds() []int {
+	if len(c.Thresholds) == 0 {
+		return defaultBudgetThresholds
+	}
+	thresholds := append([]int(nil), c.Thresholds...)
+	sort.Ints(thresholds)
+	return thresholds
+}
+
+// projectBudget returns the budget configured for a project
+func (c BudgetConfig) projectBudget(project string) (Budget, bool) {
+	if project == "" {
+		return Budget{}, false
+	}
+	homeDir, _ := os.UserHomeDir()
+	for path, budget := range c.Projects {
+		if strings.HasPrefix(path, "~/") {
+			path = filepath.Join(homeDir, path[2:])
+		}
+		if filepath.Clean(path) == filepath.Clean(project) {
+			return budget, true
+		}
+	}
+	return Budget{}, false
+}
+
+// budgetUsage compares global and project spend with the configured budgets.
+// It returns the usage of every configured budget and the overall warning level.
+func budgetUsage(config BudgetConfig, project string, dayCost, weekCost, monthCost float64, projectStats ProjectStats) ([]themes.BudgetUsage, int) {
+	var usages []themes.BudgetUsage
+	add := func(period, project string, spent, limit float64) {
+		if limit <= 0 {
+			return
+		}
+		usages = append(usages, themes.BudgetUsage{
+			Period:  period,
+			Project: project,
+			Spent:   spent,
+			Limit:   limit,
+			Percent: int(spent * 100 / limit),
+		})
+	}
+
+	projectBudget, hasProjectBudget := config.projectBudget(project)
+	add("day", "", dayCost, config.Daily)
+	if hasProjectBudget {
+		add("day", project, projectStats.DayCost, projectBudget.Daily)
+	}
+	add("week", "", weekCost, config.Weekly)
+	if hasProjectBudget {
+		add("week", project, projectStats.WeekCost, projectBudget.Weekly)
+	}
+	add("month", "", monthCost, config.Monthly)
+	if hasProjectBudget {
+		add("month", project, projectStats.MonthCost, projectBudget.Monthly)
+	}
+
+	return usages, budgetLevel(config, usages)
+}
+
+// addBudgetSpend adds cost spent in the current session's project to every
+// budget, as all of them cover the current day, week and month
+func addBudgetSpend(config BudgetConfig, usages []themes.BudgetUsage, cost float64) ([]themes.BudgetUsage, int) {
+	updated := make([]themes.BudgetUsage, len(usages))
+	for i, usage := range usages {
+		usage.Spent += cost
+		usage.Percent = int(usage.Spent * 100 / usage.Limit)
+		updated[i] = usage
+	}
+	return updated, budgetLevel(config, updated)
+}
+
+// budgetLevel returns the overall warning level of the budget usages
+func budgetLevel(config BudgetConfig, usages []themes.BudgetUsage) int {
+	level := themes.BudgetOK
+	warnAt := config.thresholds()[0]
+	for _, usage := range usages {
+		if usage.Percent >= 100 {
+			level = themes.BudgetOver
+		} else if usage.Percent >= warnAt && level < themes.BudgetWarn {
+			level = themes.BudgetWarn
+		}
+	}
+	return level
+}
+
+// budgetAlertsPath returns the file recording which budget thresholds already fired
+func budgetAlertsPath() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".claude", "session-tracker", "budget-alerts.json")
+}
+
+// budgetPeriodKey identifies the day, week or month a budget applies to
+func budgetPeriodKey(period string, now time.Time) string {
+	switch period {
+	case "week":
+		return weekStartKey(now)
+	case "month":
+		return monthKey(now)
+	}
+	return dayKey(now)
+}
+
+// fireBudgetAlerts runs the hook once for each budget period whose spend crossed
+// a threshold not yet alerted. When several thresholds are crossed at once only
+// the highest one is reported. Fired alerts are kept for 60 days.
+func fireBudgetAlerts(config BudgetConfig, usages []themes.BudgetUsage, now time.Time) {
+	if config.Hook == "" || len(usages) == 0 {
+		return
+	}
+
+	path := budgetAlertsPath()
+	withFileLock(path, func() {
+		fired := make(map[string]int64)
+		if data, err := os.ReadFile(path); err == nil {
+			json.Unmarshal(data, &fired)
+		}
+
+		changed := false
+		for key, firedAt := range fired {
+			if now.Unix()-firedAt > 60*24*3600 {
+				delete(fired, key)
+				changed = true
+			}
+		}
+
+		for _, usage := range usages {
+			keyPrefix := fmt.Sprintf("%s|%s|%s|", usage.Project, usage.Period, budgetPeriodKey(usage.Period, now))
+			crossed := 0
+			for _, threshold := range config.thresholds() {
+				key := keyPrefix + fmt.Sprint(threshold)
+				if usage.Percent < threshold || fired[key] != 0 {
+					continue
+				}
+				fired[key] = now.Unix()
+				crossed = threshold
+				changed = true
+			}
+			if crossed > 0 {
+				runBudgetHook(config.Hook, usage, crossed)
+			}
+		}
+
+		if changed {
+			if data, err := json.Marshal(fired); err == nil {
+				writeFileAtomic(path, data, 0644)
+			}
+		}
+	})
+}
+
+// runBudgetHook starts the hook command without waiting for it.
+// The alert details are passed in STATUSLINE_BUDGET_* environment variables.
+func runBudgetHook(hook string, usage themes.BudgetUsage, threshold int) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", hook)
+	} else {
+		cmd = exec.Command("sh", "-c", hook)
+	}
+
+	scope := "global"
+	if usage.Project != "" {
+		scope = usage.Project
+	}
+	cmd.Env = append(os.Environ(),
+		"STATUSLINE_BUDGET_PERIOD="+usage.Period,
+		"STATUSLINE_BUDGET_SCOPE="+scope,
+		fmt.Sprintf("STATUSLINE_BUDGET_THRESHOLD=%d", threshold),
+		fmt.Sprintf("STATUSLINE_BUDGET_PERCENT=%d", usage.Percent),
+		fmt.Sprintf("STATUSLINE_BUDGET_SPENT=%.2f", usage.Spent),
+		fmt.Sprintf("STATUSLINE_BUDGET_LIMIT=%.2f", usage.Limit),
+		fmt.Sprintf("STATUSLINE_BUDGET_MESSAGE=Claude %s budget (%s) at %d%%: $%.2f of $%.2f",
+			usage.Period, scope, usage.Percent, usage.Spent, usage.Limit),
+	)
+	cmd.Start()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Stats clock: the timezone, day start hour and first weekday that stats keys use
+var (
+	statsLocation  = time.Local
+	statsDayStart  = 0 // Hour at which a stats day begins
+	statsWeekStart = time.Monday
+)
+
+// setClockConfig installs the configured stats clock. An unknown timezone or
+// weekday falls back to local time and Monday.
+func setClockConfig(timezone string, dayStartHour int, weekStart string) {
+	statsLocation = time.Local
+	if timezone != "" {
+		if loc, err := time.LoadLocation(timezone); err == nil {
+			statsLocation = loc
+		}
+	}
+
+	statsDayStart = 0
+	if dayStartHour > 0 && dayStartHour < 24 {
+		statsDayStart = dayStartHour
+	}
+
+	statsWeekStart = time.Monday
+	if weekday, ok := parseWeekday(weekStart); ok {
+		statsWeekStart = weekday
+	}
+}
+
+// parseWeekday parses a weekday name such as "sunday" or "Sun"
+func parseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) < 3 {
+		return 0, false
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.HasPrefix(strings.ToLower(day.String()), name) {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// clockFingerprint identifies the stats clock, so day-keyed data is rebuilt when it changes
+func clockFingerprint() string {
+	return fmt.Sprintf("%s/%d/%s", statsLocation, statsDayStart, statsWeekStart)
+}
+
+// statsTime converts t to the stats clock: its calendar date is the stats day
+func statsTime(t time.Time) time.Time {
+	return t.In(statsLocation).Add(-time.Duration(statsDayStart) * time.Hour)
+}
+
+// dayKey returns the stats day key for a time
+func dayKey(t time.Time) string {
+	return statsTime(t).Format("2006-01-02")
+}
+
+// weekStartKey returns the day key of the first day of t's stats week
+func weekStartKey(t time.Time) string {
+	st := statsTime(t)
+	offset := (int(st.Weekday()) - int(statsWeekStart) + 7) % 7
+	return st.AddDate(0, 0, -offset).Format("2006-01-02")
+}
+
+// monthKey returns the stats month key for a time
+func monthKey(t time.Time) string {
+	return statsTime(t).Format("2006-01")
+}
+
+// dayKeyStart returns the moment a stats day begins
+func dayKeyStart(day string) (time.Time, error) {
+	date, err := time.ParseInLocation("2006-01-02", day, statsLocation)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return date.Add(time.Duration(statsDayStart) * time.Hour), nil
+}
+
+// shiftDayKey moves a day key by a number of calendar days
+func shiftDayKey(day string, days int) string {
+	date, err := time.Parse("2006-01-02", day)
+	if err != nil {
+		return day
+	}
+	return date.AddDate(0, 0, days).Format("2006-01-02")
+}
+
+// periodRange returns the day keys [from, to) of the stats day, week or month containing t
+func periodRange(period string, t time.Time) (string, string) {
+	switch period {
+	case "week":
+		from := weekStartKey(t)
+		return from, shiftDayKey(from, 7)
+	case "month":
+		from := monthKey(t) + "-01"
+		date, _ := time.Parse("2006-01-02", from)
+		return from, date.AddDate(0, 1, 0).Format("2006-01-02")
+	}
+	from := dayKey(t)
+	return from, shiftDayKey(from, 1)
+}
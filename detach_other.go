@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package main
+
+import "os/exec"
+
+// detachProcess leaves cmd as is on platforms without session control
+func detachProcess(cmd *exec.Cmd) {}
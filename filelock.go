@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// withFileLock runs fn while holding an exclusive advisory lock on path+".lock".
+// Concurrent statusline processes (one per Claude Code window) serialize their
+// read-modify-write of shared files this way. If the lock cannot be taken, fn
+// still runs: a lost update is better than a missing statusline.
+func withFileLock(path string, fn func()) {
+	os.MkdirAll(filepath.Dir(path), 0755)
+
+	lockFile, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		fn()
+		return
+	}
+	defer lockFile.Close()
+
+	if err := lockExclusive(lockFile); err == nil {
+		defer unlockFile(lockFile)
+	}
+	fn()
+}
+
+// tryWithFileLock runs fn under the lock of path if no other process holds it.
+// It reports whether fn ran.
+func tryWithFileLock(path string, fn func()) bool {
+	os.MkdirAll(filepath.Dir(path), 0755)
+
+	lockFile, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return false
+	}
+	defer lockFile.Close()
+
+	if err := tryLockExclusive(lockFile); err != nil {
+		return false
+	}
+	defer unlockFile(lockFile)
+	fn()
+	return true
+}
+
+// writeFileAtomic writes data to a temp file in the same directory and renames
+// it over path, so readers never see a half-written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
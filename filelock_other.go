@@ -0,0 +1,20 @@
+//go:build !unix && !windows
+
+package main
+
+import "os"
+
+// lockExclusive is a no-op on platforms without advisory file locks
+func lockExclusive(f *os.File) error {
+	return nil
+}
+
+// unlockFile is a no-op on platforms without advisory file locks
+func unlockFile(f *os.File) error {
+	return nil
+}
+
+// tryLockExclusive is a no-op on platforms without advisory file locks
+func tryLockExclusive(f *os.File) error {
+	return nil
+}
@@ -6,4 +6,4 @@ toolchain go1.24.13
 
 require golang.org/x/term v0.40.0
 
-require golang.org/x/sys v0.41.0 // indirect
+require golang.org/x/sys v0.41.0
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LedgerRecord is one entry in the append-only cost ledger: the increase in a
+// session's cost (and tokens) for one model since its previous record.
+type LedgerRecord struct {
+	Time    int64   `json:"ts"`
+	Session string  `json:"session"`
+	Project string  `json:"project,omitempty"`
+	Model   string  `json:"model,omitempty"`
+	Cost    float64 `json:"cost"`
+	Tokens  int64   `json:"tokens,omitempty"`
+}
+
+// ledgerAmount is a cost and token amount
+type ledgerAmount struct {
+	Cost   float64 `json:"cost"`
+	Tokens int64   `json:"tokens,omitempty"`
+	Last   int64   `json:"last,omitempty"` // Time of the latest record
+}
+
+// LedgerTotals sums ledger records over a period
+type LedgerTotals struct {
+	Cost     float64            `json:"cost"`
+	Tokens   int64              `json:"tokens,omitempty"`
+	Projects map[string]float64 `json:"projects,omitempty"`
+	Models   map[string]float64 `json:"models,omitempty"`
+}
+
+// LedgerIndex is a compact summary of the ledger for fast reads.
+// It is derived data: a missing or stale index is rebuilt by replaying the ledger.
+type LedgerIndex struct {
+	Offset   int64                              `json:"offset"` // Ledger bytes folded into the index
+	Clock    string                             `json:"clock"`  // Stats clock the day keys were computed with
+	Days     map[string]LedgerTotals            `json:"days"`
+	Sessions map[string]map[string]ledgerAmount `json:"sessions"` // Session -> model -> recorded total
+}
+
+// ledgerPath returns the path of the append-only cost ledger
+func ledgerPath() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".claude", "session-tracker", "ledger.jsonl")
+}
+
+// ledgerIndexPath returns the path of the ledger index
+func ledgerIndexPath() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".claude", "session-tracker", "ledger-index.json")
+}
+
+// loadLedgerIndex loads the ledger index and folds in any ledger records it has not seen yet
+func loadLedgerIndex() LedgerIndex {
+	idx, _ := loadLedgerIndexState()
+	return idx
+}
+
+// loadLedgerIndexState is loadLedgerIndex, also reporting whether the index
+// differs from the saved one. An index keyed with another stats clock is rebuilt.
+func loadLedgerIndexState() (LedgerIndex, bool) {
+	var idx LedgerIndex
+	if data, err := os.ReadFile(ledgerIndexPath()); err == nil {
+		if err := json.Unmarshal(data, &idx); err != nil {
+			idx = LedgerIndex{}
+		}
+	}
+	saved := idx.Offset
+	if idx.Clock != clockFingerprint() {
+		idx = LedgerIndex{}
+		saved = -1
+	}
+
+	idx.catchUp(ledgerPath())
+	idx.Clock = clockFingerprint()
+	return idx, idx.Offset != saved
+}
+
+// catchUp replays ledger records after the index offset.
+// If the ledger is shorter than the offset it was replaced, so the index is rebuilt.
+func (idx *LedgerIndex) catchUp(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		if idx.Offset > 0 {
+			*idx = LedgerIndex{}
+		}
+		return
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err != nil || info.Size() < idx.Offset {
+		*idx = LedgerIndex{}
+	}
+	if _, err := file.Seek(idx.Offset, io.SeekStart); err != nil {
+		return
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// A partial trailing record is still being written or was cut off
+			break
+		}
+		idx.Offset += int64(len(line))
+
+		var rec LedgerRecord
+		if err := json.Unmarshal(line, &rec); err == nil {
+			idx.apply(rec)
+		}
+	}
+}
+
+// apply folds one ledger record into the index
+func (idx *LedgerIndex) apply(rec LedgerRecord) {
+	if idx.Days == nil {
+		idx.Days = make(map[string]LedgerTotals)
+	}
+	if idx.Sessions == nil {
+		idx.Sessions = make(map[string]map[string]ledgerAmount)
+	}
+
+	day := dayKey(time.Unix(rec.Time, 0))
+	totals := idx.Days[day]
+	totals.add(rec)
+	idx.Days[day] = totals
+
+	models := idx.Sessions[rec.Session]
+	if models == nil {
+		models = make(map[string]ledgerAmount)
+		idx.Sessions[rec.Session] = models
+	}
+	amount := models[rec.Model]
+	amount.Cost += rec.Cost
+	amount.Tokens += rec.Tokens
+	amount.Last = max(amount.Last, rec.Time)
+	models[rec.Model] = amount
+}
+
+// add accumulates one ledger record
+func (t *LedgerTotals) add(rec LedgerRecord) {
+	t.Cost += rec.Cost
+	t.Tokens += rec.Tokens
+	if rec.Project != "" {
+		if t.Projects == nil {
+			t.Projects = make(map[string]float64)
+		}
+		t.Projects[rec.Project] += rec.Cost
+	}
+	if rec.Model != "" {
+		if t.Models == nil {
+			t.Models = make(map[string]float64)
+		}
+		t.Models[rec.Model] += rec.Cost
+	}
+}
+
+// merge accumulates another period's totals
+func (t *LedgerTotals) merge(other LedgerTotals) {
+	t.Cost += other.Cost
+	t.Tokens += other.Tokens
+	for project, cost := range other.Projects {
+		if t.Projects == nil {
+			t.Projects = make(map[string]float64)
+		}
+		t.Projects[project] += cost
+	}
+	for model, cost := range other.Models {
+		if t.Models == nil {
+			t.Models = make(map[string]float64)
+		}
+		t.Models[model] += cost
+	}
+}
+
+// totalsBetween sums the day totals for day keys in [fromDay, toDay)
+func (idx *LedgerIndex) totalsBetween(fromDay, toDay string) LedgerTotals {
+	var totals LedgerTotals
+	for day, dayTotals := range idx.Days {
+		if day >= fromDay && day < toDay {
+			totals.merge(dayTotals)
+		}
+	}
+	return totals
+}
+
+// appendLedger records the increase of a session's per-model cumulative totals
+// since they were last recorded, and returns the cost it recorded
+func appendLedger(sessionID, project string, totals map[string]ledgerAmount, now time.Time) float64 {
+	return recordLedger(sessionID, func(idx *LedgerIndex) []LedgerRecord {
+		models := make([]string, 0, len(totals))
+		for model := range totals {
+			models = append(models, model)
+		}
+		sort.Strings(models)
+
+		records := legacyTransfer(idx.Sessions[sessionID], sessionID, project, totals, now)
+		moved := make(map[string]float64)
+		for _, rec := range records {
+			moved[rec.Model] += rec.Cost
+		}
+		for _, model := range models {
+			recorded := idx.Sessions[sessionID][model]
+			recorded.Cost += moved[model]
+			delta := totals[model].Cost - recorded.Cost
+			if delta <= 0 {
+				continue
+			}
+			records = append(records, LedgerRecord{
+				Time:    now.Unix(),
+				Session: sessionID,
+				Project: project,
+				Model:   model,
+				Cost:    delta,
+				Tokens:  max(totals[model].Tokens-recorded.Tokens, 0),
+			})
+		}
+		return records
+	})
+}
+
+// appendLedgerSessionTotal records the increase of a session's cumulative total
+// that is not split by model, such as Claude Code's official cost, and returns
+// the cost it recorded. The increase is measured against everything recorded for
+// the session under any model and booked under the current model, so switching
+// models mid-session never counts earlier spend again.
+func appendLedgerSessionTotal(sessionID, project, model string, total ledgerAmount, now time.Time) float64 {
+	return recordLedger(sessionID, func(idx *LedgerIndex) []LedgerRecord {
+		var recorded ledgerAmount
+		for _, amount := range idx.Sessions[sessionID] {
+			recorded.Cost += amount.Cost
+			recorded.Tokens += amount.Tokens
+		}
+		delta := total.Cost - recorded.Cost
+		if delta <= 0 {
+			return nil
+		}
+		return []LedgerRecord{{
+			Time:    now.Unix(),
+			Session: sessionID,
+			Project: project,
+			Model:   model,
+			Cost:    delta,
+			Tokens:  max(total.Tokens-recorded.Tokens, 0),
+		}}
+	})
+}
+
+// recordLedger appends the records built from the current ledger index for a
+// session and returns their total cost. The ledger and its index are updated
+// under one lock so concurrent statusline processes never double count. A
+// session that was pruned from the index gets its recorded totals back from
+// the monthly summaries first, so a resumed session only books new spend.
+func recordLedger(sessionID string, build func(idx *LedgerIndex) []LedgerRecord) float64 {
+	var recorded float64
+	path := ledgerPath()
+	withFileLock(path, func() {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			importLegacyStats(path)
+		}
+
+		idx, changed := loadLedgerIndexState()
+		if _, ok := idx.Sessions[sessionID]; !ok {
+			if pruned := prunedLedgerTotals(sessionID); pruned != nil {
+				if idx.Sessions == nil {
+					idx.Sessions = make(map[string]map[string]ledgerAmount)
+				}
+				idx.Sessions[sessionID] = pruned
+			}
+		}
+		if records := build(&idx); len(records) > 0 {
+			written, err := writeLedgerRecords(path, idx.Offset, records)
+			if err != nil {
+				return
+			}
+			for _, rec := range records {
+				idx.apply(rec)
+				recorded += rec.Cost
+			}
+			idx.Offset += written
+			changed = true
+		}
+
+		if changed {
+			if data, err := json.Marshal(idx); err == nil {
+				writeFileAtomic(ledgerIndexPath(), data, 0644)
+			}
+		}
+	})
+	return recorded
+}
+
+// forgetLedgerSessions drops the recorded totals of pruned sessions from the
+// ledger index so it does not grow without bound, and returns the number of
+// sessions dropped. Their totals are kept in the monthly summaries. The ledger
+// itself is untouched; an index rebuilt from it brings the sessions back.
+func forgetLedgerSessions(ids []string) int {
+	dropped := 0
+	path := ledgerPath()
+	withFileLock(path, func() {
+		idx, changed := loadLedgerIndexState()
+		forget := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			forget[id] = true
+		}
+		for id := range idx.Sessions {
+			if forget[id] {
+				delete(idx.Sessions, id)
+				dropped++
+			}
+		}
+
+		if changed || dropped > 0 {
+			if data, err := json.Marshal(idx); err == nil {
+				writeFileAtomic(ledgerIndexPath(), data, 0644)
+			}
+		}
+	})
+	return dropped
+}
+
+// legacyTransfer attributes a session's imported legacy cost, which has no
+// model, to the models it is now known to have used, in proportion to their
+// current totals. The records move the cost between models on the day it was
+// last recorded, so day totals are unchanged and later deltas per model are
+// measured against the session's whole recorded cost.
+func legacyTransfer(recorded map[string]ledgerAmount, sessionID, project string, totals map[string]ledgerAmount, now time.Time) []LedgerRecord {
+	legacy := recorded[""]
+	var sessionTotal float64
+	for model, amount := range totals {
+		if model != "" {
+			sessionTotal += amount.Cost
+		}
+	}
+	if math.Abs(legacy.Cost) < 1e-9 || sessionTotal <= 0 {
+		return nil
+	}
+
+	ts := legacy.Last
+	if ts == 0 {
+		ts = now.Unix()
+	}
+	records := []LedgerRecord{{Time: ts, Session: sessionID, Project: project, Cost: -legacy.Cost}}
+
+	models := make([]string, 0, len(totals))
+	for model := range totals {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		if model == "" || totals[model].Cost <= 0 {
+			continue
+		}
+		records = append(records, LedgerRecord{
+			Time:    ts,
+			Session: sessionID,
+			Project: project,
+			Model:   model,
+			Cost:    legacy.Cost * totals[model].Cost / sessionTotal,
+		})
+	}
+	return records
+}
+
+// writeLedgerRecords appends records to the ledger and returns the bytes written
+// past offset. A partial trailing record left by an interrupted write is
+// terminated first so it cannot swallow the new records.
+func writeLedgerRecords(path string, offset int64, records []LedgerRecord) (int64, error) {
+	var sb strings.Builder
+	for _, rec := range records {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return 0, err
+		}
+		sb.Write(data)
+		sb.WriteByte('\n')
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var written int64
+	if info, err := file.Stat(); err == nil && info.Size() > offset {
+		n, err := file.WriteString("\n")
+		if err != nil {
+			return 0, err
+		}
+		written += info.Size() - offset + int64(n)
+	}
+
+	n, err := file.WriteString(sb.String())
+	if err != nil {
+		return 0, err
+	}
+	return written + int64(n), nil
+}
+
+// importLegacyStats seeds a new ledger from the daily-*.json rollups written by
+// earlier versions. Each session's cost increase per day becomes one record at
+// noon of that day; the session's cost is only counted once across days.
+func importLegacyStats(path string) {
+	homeDir, _ := os.UserHomeDir()
+	statsDir := filepath.Join(homeDir, ".claude", "session-tracker", "stats")
+	files, _ := filepath.Glob(filepath.Join(statsDir, "daily-*.json"))
+	if len(files) == 0 {
+		return
+	}
+	sort.Strings(files)
+
+	recorded := make(map[string]float64)
+	var records []LedgerRecord
+	for _, file := range files {
+		day := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "daily-"), ".json")
+		date, err := time.ParseInLocation("2006-01-02", day, time.Local)
+		if err != nil {
+			continue
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var stats UsageStats
+		if err := json.Unmarshal(data, &stats); err != nil {
+			continue
+		}
+
+		sessions := make([]string, 0, len(stats.SessionCosts))
+		for sessionID := range stats.SessionCosts {
+			sessions = append(sessions, sessionID)
+		}
+		sort.Strings(sessions)
+
+		for _, sessionID := range sessions {
+			delta := stats.SessionCosts[sessionID] - recorded[sessionID]
+			if delta <= 0 {
+				continue
+			}
+			recorded[sessionID] += delta
+			records = append(records, LedgerRecord{
+				Time:    date.Add(12 * time.Hour).Unix(),
+				Session: sessionID,
+				Cost:    delta,
+			})
+		}
+	}
+
+	if len(records) > 0 {
+		writeLedgerRecords(path, 0, records)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+// longContextThreshold is the prompt size above which a request is billed at
+// long-context rates (1M-context models only)
+const longContextThreshold = 200000
+
+// ModelPrice is a model's price per 1M tokens
+type ModelPrice struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheRead  float64 `json:"cache_read"`
+	CacheWrite float64 `json:"cache_write"` // 5-minute cache write
+
+	// CacheWrite1h is the 1-hour cache write price; zero means twice the input price
+	CacheWrite1h float64 `json:"cache_write_1h,omitempty"`
+
+	// LongContext replaces the prices above for requests over longContextThreshold
+	LongContext *ModelPrice `json:"long_context,omitempty"`
+}
+
+// Long-context rates for models with a 1M context window
+var (
+	opusLongContext   = &ModelPrice{Input: 10.0, Output: 37.5, CacheRead: 1.0, CacheWrite: 12.5}
+	sonnetLongContext = &ModelPrice{Input: 6.0, Output: 22.5, CacheRead: 0.6, CacheWrite: 7.5}
+)
+
+// cacheWrite1h returns the 1-hour cache write price
+func (p ModelPrice) cacheWrite1h() float64 {
+	if p.CacheWrite1h > 0 {
+		return p.CacheWrite1h
+	}
+	return p.Input * 2
+}
+
+// PricingRule prices the models whose normalized ID contains Pattern.
+// When several rules match, the longest pattern wins.
+type PricingRule struct {
+	Pattern string
+	Family  string // Opus, Sonnet, Haiku
+	Price   ModelPrice
+}
+
+// Built-in model pricing (per 1M tokens), most specific versions first.
+// Patterns are matched against normalized model names, see normalizeModelName.
+var modelPricing = []PricingRule{
+	{"opus-4-6", "Opus", ModelPrice{Input: 5.0, Output: 25.0, CacheRead: 0.5, CacheWrite: 6.25, LongContext: opusLongContext}},
+	{"opus-4-5", "Opus", ModelPrice{Input: 5.0, Output: 25.0, CacheRead: 0.5, CacheWrite: 6.25}},
+	{"opus-4-1", "Opus", ModelPrice{Input: 15.0, Output: 75.0, CacheRead: 1.5, CacheWrite: 18.75}},
+	{"opus-4-0", "Opus", ModelPrice{Input: 15.0, Output: 75.0, CacheRead: 1.5, CacheWrite: 18.75}},
+	{"opus-4-2025", "Opus", ModelPrice{Input: 15.0, Output: 75.0, CacheRead: 1.5, CacheWrite: 18.75}}, // Dated Opus 4 snapshots
+	{"3-opus", "Opus", ModelPrice{Input: 15.0, Output: 75.0, CacheRead: 1.5, CacheWrite: 18.75}},
+	{"opus", "Opus", ModelPrice{Input: 5.0, Output: 25.0, CacheRead: 0.5, CacheWrite: 6.25}},
+	{"sonnet", "Sonnet", ModelPrice{Input: 3.0, Output: 15.0, CacheRead: 0.3, CacheWrite: 3.75, LongContext: sonnetLongContext}},
+	{"haiku-4-5", "Haiku", ModelPrice{Input: 1.0, Output: 5.0, CacheRead: 0.1, CacheWrite: 1.25}},
+	{"3-5-haiku", "Haiku", ModelPrice{Input: 0.8, Output: 4.0, CacheRead: 0.08, CacheWrite: 1.0}},
+	{"3-haiku", "Haiku", ModelPrice{Input: 0.25, Output: 1.25, CacheRead: 0.03, CacheWrite: 0.3}},
+	{"haiku", "Haiku", ModelPrice{Input: 1.0, Output: 5.0, CacheRead: 0.1, CacheWrite: 1.25}},
+}
+
+// userPricing holds the rules from config.pricing; they take precedence over the built-in table
+var userPricing []PricingRule
+
+// setPricingConfig installs the user-configured pricing rules.
+// Keys are model-ID patterns such as "claude-opus-4-1"; the model family is
+// taken from the built-in rule the pattern itself matches.
+func setPricingConfig(pricing map[string]ModelPrice) {
+	userPricing = nil
+	for pattern, price := range pricing {
+		normalized := normalizeModelName(pattern)
+		if normalized == "" {
+			continue
+		}
+		family := "Sonnet"
+		if rule, ok := matchPricingRule(modelPricing, normalized); ok {
+			family = rule.Family
+		}
+		userPricing = append(userPricing, PricingRule{Pattern: normalized, Family: family, Price: price})
+	}
+	sort.Slice(userPricing, func(i, j int) bool {
+		return userPricing[i].Pattern < userPricing[j].Pattern
+	})
+}
+
+// normalizeModelName turns model IDs and display names into a common form,
+// e.g. "claude-opus-4-1-20250805" and "Claude Opus 4.1" both become "opus-4-1..."
+func normalizeModelName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.NewReplacer(" ", "-", ".", "-", "_", "-").Replace(name)
+	return strings.TrimPrefix(name, "claude-")
+}
+
+// matchPricingRule returns the rule with the longest pattern contained in the normalized name
+func matchPricingRule(rules []PricingRule, normalized string) (PricingRule, bool) {
+	var best PricingRule
+	found := false
+	for _, rule := range rules {
+		if strings.Contains(normalized, rule.Pattern) && (!found || len(rule.Pattern) > len(best.Pattern)) {
+			best = rule
+			found = true
+		}
+	}
+	return best, found
+}
+
+// lookupPricing finds the pricing rule for a model ID or display name,
+// checking user-configured rules before the built-in table
+func lookupPricing(model string) (PricingRule, bool) {
+	normalized := normalizeModelName(model)
+	if normalized == "" {
+		return PricingRule{}, false
+	}
+	if rule, ok := matchPricingRule(userPricing, normalized); ok {
+		return rule, true
+	}
+	return matchPricingRule(modelPricing, normalized)
+}
+
+// modelPrice returns the price for a model ID, display name or model type,
+// falling back to Sonnet pricing for unknown models
+func modelPrice(model string) ModelPrice {
+	rule, ok := lookupPricing(model)
+	if !ok {
+		rule, _ = lookupPricing("Sonnet")
+	}
+	return rule.Price
+}
+
+// pricingFingerprint identifies the active pricing tables, so costs saved in
+// transcript cursors are recomputed when prices change
+func pricingFingerprint() string {
+	h := fnv.New64a()
+	json.NewEncoder(h).Encode([][]PricingRule{modelPricing, userPricing})
+	return fmt.Sprintf("%x", h.Sum64())
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rebuildSession collects one session's usage while rebuilding stats from transcripts
+type rebuildSession struct {
+	project string // Working directory until scanning ends, then its project root
+	recent  dedupWindow
+	times   []int64
+	records map[rebuildBucket]*LedgerRecord
+}
+
+// rebuildBucket keys the rebuilt ledger records: one per session, day and model
+type rebuildBucket struct {
+	day   string
+	model string
+}
+
+// RebuildResult summarizes a stats rebuild
+type RebuildResult struct {
+	Transcripts int
+	Sessions    int
+	Before      map[string]float64 // Month -> cost in the ledger before the rebuild
+	After       map[string]float64 // Month -> cost after the rebuild
+}
+
+// runRebuildStats handles --rebuild-stats
+func runRebuildStats(sinceFlag string, dryRun bool) {
+	config := loadConfig()
+	applyConfig(config)
+
+	var since time.Time
+	if sinceFlag != "" {
+		t, err := dayKeyStart(sinceFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --since date %q, expected YYYY-MM-DD\n", sinceFlag)
+			os.Exit(1)
+		}
+		since = t
+	}
+
+	result := rebuildStats(since, dryRun)
+	if !dryRun {
+		// Sessions rebuilt from old transcripts go straight back into the monthly summaries
+		pruneSessions(config.retentionDays(), time.Now(), false)
+	}
+	fmt.Printf("Transcripts: %d, sessions: %d\n\n", result.Transcripts, result.Sessions)
+
+	months := make(map[string]bool)
+	for month := range result.Before {
+		months[month] = true
+	}
+	for month := range result.After {
+		months[month] = true
+	}
+	sorted := make([]string, 0, len(months))
+	for month := range months {
+		sorted = append(sorted, month)
+	}
+	sort.Strings(sorted)
+
+	fmt.Printf("%-9s %12s %12s\n", "Month", "Before", "After")
+	for _, month := range sorted {
+		fmt.Printf("%-9s %12s %12s\n", month,
+			fmt.Sprintf("$%.2f", result.Before[month]),
+			fmt.Sprintf("$%.2f", result.After[month]))
+	}
+
+	if dryRun {
+		fmt.Println("\nDry run: no files were written")
+	}
+}
+
+// rebuildStats re-parses every transcript under ~/.claude/projects and regenerates
+// the cost ledger and session files from it. Ledger records of the rebuilt
+// sessions from since onwards are replaced, so repeated runs give the same totals;
+// sessions whose transcripts are gone keep their recorded costs.
+func rebuildStats(since time.Time, dryRun bool) RebuildResult {
+	homeDir, _ := os.UserHomeDir()
+	sessions, transcripts := scanTranscripts(filepath.Join(homeDir, ".claude", "projects"))
+
+	result := RebuildResult{Transcripts: transcripts, Sessions: len(sessions)}
+	path := ledgerPath()
+
+	withFileLock(path, func() {
+		if _, err := os.Stat(path); os.IsNotExist(err) && !dryRun {
+			importLegacyStats(path)
+		}
+
+		existing := readLedgerRecords(path)
+		records := make([]LedgerRecord, 0, len(existing))
+		for _, rec := range existing {
+			if _, rebuilt := sessions[rec.Session]; rebuilt && rec.Time >= since.Unix() {
+				continue
+			}
+			records = append(records, rec)
+		}
+		for _, session := range sessions {
+			for _, rec := range session.records {
+				if rec.Cost > 0 && rec.Time >= since.Unix() {
+					records = append(records, *rec)
+				}
+			}
+		}
+		sort.SliceStable(records, func(i, j int) bool {
+			if records[i].Time != records[j].Time {
+				return records[i].Time < records[j].Time
+			}
+			if records[i].Session != records[j].Session {
+				return records[i].Session < records[j].Session
+			}
+			return records[i].Model < records[j].Model
+		})
+
+		result.Before = monthlyCosts(existing)
+		result.After = monthlyCosts(records)
+		if dryRun {
+			return
+		}
+
+		var buf bytes.Buffer
+		idx := LedgerIndex{Clock: clockFingerprint()}
+		for _, rec := range records {
+			data, err := json.Marshal(rec)
+			if err != nil {
+				continue
+			}
+			buf.Write(data)
+			buf.WriteByte('\n')
+			idx.apply(rec)
+		}
+		idx.Offset = int64(buf.Len())
+
+		if err := writeFileAtomic(path, buf.Bytes(), 0644); err != nil {
+			return
+		}
+		if data, err := json.Marshal(idx); err == nil {
+			writeFileAtomic(ledgerIndexPath(), data, 0644)
+		}
+	})
+
+	if !dryRun {
+		for sessionID, session := range sessions {
+			if len(session.times) > 0 && session.times[len(session.times)-1] >= since.Unix() {
+				writeRebuiltSession(sessionID, session.project, session.times)
+			}
+		}
+	}
+	return result
+}
+
+// scanTranscripts parses every transcript below dir, grouping usage by session ID.
+// It returns the sessions and the number of transcript files read.
+func scanTranscripts(dir string) (map[string]*rebuildSession, int) {
+	var files []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && strings.HasSuffix(path, ".jsonl") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+
+	sessions := make(map[string]*rebuildSession)
+	for _, path := range files {
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		reader := bufio.NewReader(file)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				addRebuildLine(sessions, line)
+			}
+			if err != nil {
+				break
+			}
+		}
+		file.Close()
+	}
+
+	// Attribute sessions as live renders do: keep the project a session file
+	// already records, else use the git toplevel of the launch directory
+	roots := make(map[string]string)
+	for sessionID, session := range sessions {
+		sort.Slice(session.times, func(i, j int) bool { return session.times[i] < session.times[j] })
+
+		if existing, ok := loadSession(sessionID); ok && existing.Project != "" {
+			session.project = existing.Project
+		} else {
+			if _, ok := roots[session.project]; !ok {
+				roots[session.project] = projectRoot(session.project)
+			}
+			session.project = roots[session.project]
+		}
+		for _, rec := range session.records {
+			rec.Project = session.project
+		}
+	}
+	return sessions, len(files)
+}
+
+// addRebuildLine accumulates one transcript line into its session.
+// Subagent sidechains are included: their spend is billed like the main thread.
+func addRebuildLine(sessions map[string]*rebuildSession, line []byte) {
+	var entry transcriptEntry
+	if err := json.Unmarshal(line, &entry); err != nil || entry.SessionID == "" {
+		return
+	}
+	t, err := time.Parse(time.RFC3339, entry.Timestamp)
+	if err != nil {
+		return
+	}
+
+	session := sessions[entry.SessionID]
+	if session == nil {
+		session = &rebuildSession{
+			records: make(map[rebuildBucket]*LedgerRecord),
+		}
+		sessions[entry.SessionID] = session
+	}
+	if session.project == "" {
+		session.project = entry.CWD
+	}
+	session.times = append(session.times, t.Unix())
+
+	// Dedup with the same window as the live transcript cursor, so a rebuild
+	// reproduces the costs live renders recorded
+	if entry.Message.Usage != nil && session.recent.seen(entry.Message.ID, entry.RequestID) {
+		return
+	}
+
+	usage, model, ok := transcriptUsage(entry, "")
+	if !ok {
+		return
+	}
+	modelType := getModelType(model)
+	bucket := rebuildBucket{day: dayKey(t), model: modelType}
+	rec := session.records[bucket]
+	if rec == nil {
+		rec = &LedgerRecord{Session: entry.SessionID, Model: modelType}
+		session.records[bucket] = rec
+	}
+	rec.Time = max(rec.Time, t.Unix())
+	rec.Cost += calculateRequestCost(usage, model)
+	rec.Tokens += usage.InputTokens + usage.OutputTokens + usage.CacheReadTokens + usage.CacheWriteTokens
+}
+
+// writeRebuiltSession regenerates a session file from the session's transcript timestamps,
+// splitting activity into intervals the same way heartbeats do
+func writeRebuiltSession(sessionID, project string, times []int64) {
+	homeDir, _ := os.UserHomeDir()
+	sessionsDir := filepath.Join(homeDir, ".claude", "session-tracker", "sessions")
+	os.MkdirAll(sessionsDir, 0755)
+	sessionFile := filepath.Join(sessionsDir, sessionID+".json")
+
+	last := times[len(times)-1]
+	session := Session{
+		ID:            sessionID,
+		Date:          dayKey(time.Unix(last, 0)),
+		Project:       project,
+		Start:         times[0],
+		LastHeartbeat: last,
+	}
+	for i, t := range times {
+		end := t
+		if i > 0 && t-times[i-1] < sessionIdleGap {
+			session.Intervals[len(session.Intervals)-1].End = &end
+			continue
+		}
+		session.Intervals = append(session.Intervals, Interval{Start: t, End: &end})
+	}
+	for _, interval := range session.Intervals {
+		session.TotalSeconds += *interval.End - interval.Start
+	}
+
+	withFileLock(sessionFile, func() {
+		if data, err := json.Marshal(session); err == nil {
+			writeFileAtomic(sessionFile, data, 0644)
+		}
+	})
+
+	for day := range session.summary().Seconds {
+		addToDayIndex(day, sessionID)
+	}
+}
+
+// readLedgerRecords reads all complete records from the ledger
+func readLedgerRecords(path string) []LedgerRecord {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var records []LedgerRecord
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			break
+		}
+		var rec LedgerRecord
+		if err := json.Unmarshal(line, &rec); err == nil {
+			records = append(records, rec)
+		}
+	}
+	return records
+}
+
+// monthlyCosts sums ledger records by month
+func monthlyCosts(records []LedgerRecord) map[string]float64 {
+	costs := make(map[string]float64)
+	for _, rec := range records {
+		costs[monthKey(time.Unix(rec.Time, 0))] += rec.Cost
+	}
+	return costs
+}
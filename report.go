@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kevinlincg/claude-statusline/themes"
+)
+
+// Report groupings
+const (
+	reportByDay     = "day"
+	reportByWeek    = "week"
+	reportByMonth   = "month"
+	reportByProject = "project"
+	reportByModel   = "model"
+)
+
+// ReportRow is one row of a cost report
+type ReportRow struct {
+	Key      string  `json:"key"`
+	Cost     float64 `json:"cost"`
+	Tokens   int64   `json:"tokens"`
+	Hours    float64 `json:"hours"`
+	BurnRate float64 `json:"burn_rate"` // Cost per active hour; zero under 5 minutes of activity
+	Sessions int     `json:"sessions"`
+
+	seconds    int64
+	sessionIDs map[string]bool
+}
+
+// Report is a cost report grouped by one dimension
+type Report struct {
+	By    string      `json:"by"`
+	Since string      `json:"since,omitempty"`
+	Until string      `json:"until,omitempty"`
+	Rows  []ReportRow `json:"rows"`
+	Total ReportRow   `json:"total"`
+}
+
+// runReport handles the report subcommand
+func runReport(args []string) {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	by := flags.String("by", reportByDay, "Group by day, week, month, project or model")
+	format := flags.String("format", "table", "Output format: table, csv or json")
+	since := flags.String("since", "", "First day to include (YYYY-MM-DD)")
+	until := flags.String("until", "", "Last day to include (YYYY-MM-DD)")
+	flags.Parse(args)
+
+	switch *by {
+	case reportByDay, reportByWeek, reportByMonth, reportByProject, reportByModel:
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown --by %q, expected day, week, month, project or model\n", *by)
+		os.Exit(1)
+	}
+	for _, date := range []string{*since, *until} {
+		if _, err := time.ParseInLocation("2006-01-02", date, time.Local); date != "" && err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid date %q, expected YYYY-MM-DD\n", date)
+			os.Exit(1)
+		}
+	}
+
+	applyConfig(loadConfig())
+	report := buildReport(readLedgerRecords(ledgerPath()), loadSessionSummaries(), *by, *since, *until)
+
+	switch *format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	case "csv":
+		writeReportCSV(report)
+	case "table":
+		writeReportTable(report)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown --format %q, expected table, csv or json\n", *format)
+		os.Exit(1)
+	}
+}
+
+// buildReport groups ledger costs and session activity. Days are filtered to
+// [since, until], both inclusive and optional. Active hours are counted on the
+// day an interval started; they are not split by model.
+func buildReport(records []LedgerRecord, sessions []SessionSummary, by, since, until string) Report {
+	report := Report{By: by, Since: since, Until: until}
+	inRange := func(day string) bool {
+		return (since == "" || day >= since) && (until == "" || day <= until)
+	}
+
+	rows := make(map[string]*ReportRow)
+	row := func(key string) *ReportRow {
+		if rows[key] == nil {
+			rows[key] = &ReportRow{Key: key, sessionIDs: make(map[string]bool)}
+		}
+		return rows[key]
+	}
+
+	sessionProjects := make(map[string]string)
+	for _, rec := range records {
+		day := dayKey(time.Unix(rec.Time, 0))
+		if rec.Project != "" && sessionProjects[rec.Session] == "" {
+			sessionProjects[rec.Session] = rec.Project
+		}
+		if !inRange(day) {
+			continue
+		}
+
+		key := reportKey(by, day, rec.Project, rec.Model)
+		r := row(key)
+		r.Cost += rec.Cost
+		r.Tokens += rec.Tokens
+		r.sessionIDs[rec.Session] = true
+	}
+
+	if by != reportByModel {
+		for _, session := range sessions {
+			project := session.Project
+			if project == "" {
+				project = sessionProjects[session.ID]
+			}
+			for day, seconds := range session.Seconds {
+				if !inRange(day) {
+					continue
+				}
+				r := row(reportKey(by, day, project, ""))
+				r.seconds += seconds
+				r.sessionIDs[session.ID] = true
+			}
+		}
+	}
+
+	report.Total.Key = "Total"
+	totalSessions := make(map[string]bool)
+	for _, r := range rows {
+		r.finish()
+		report.Rows = append(report.Rows, *r)
+
+		report.Total.Cost += r.Cost
+		report.Total.Tokens += r.Tokens
+		report.Total.seconds += r.seconds
+		for id := range r.sessionIDs {
+			totalSessions[id] = true
+		}
+	}
+	report.Total.sessionIDs = totalSessions
+	report.Total.finish()
+
+	sort.Slice(report.Rows, func(i, j int) bool {
+		switch by {
+		case reportByProject, reportByModel:
+			if report.Rows[i].Cost != report.Rows[j].Cost {
+				return report.Rows[i].Cost > report.Rows[j].Cost
+			}
+		}
+		return report.Rows[i].Key < report.Rows[j].Key
+	})
+	return report
+}
+
+// reportKey returns the group a cost or activity on a stats day belongs to
+func reportKey(by, day, project, model string) string {
+	switch by {
+	case reportByWeek:
+		start, _ := dayKeyStart(day)
+		return weekStartKey(start)
+	case reportByMonth:
+		return day[:7]
+	case reportByProject:
+		if project == "" {
+			return "(unknown)"
+		}
+		return project
+	case reportByModel:
+		if model == "" {
+			return "(unknown)"
+		}
+		return model
+	}
+	return day
+}
+
+// finish derives the hours, burn rate and session count
+func (r *ReportRow) finish() {
+	r.Hours = float64(r.seconds) / 3600
+	if r.seconds >= 300 {
+		r.BurnRate = r.Cost / r.Hours
+	}
+	r.Sessions = len(r.sessionIDs)
+}
+
+// writeReportTable prints a report as an aligned table
+func writeReportTable(report Report) {
+	header := strings.ToUpper(report.By[:1]) + report.By[1:]
+	keyWidth := len(header)
+	for _, r := range report.Rows {
+		keyWidth = max(keyWidth, len(r.Key))
+	}
+
+	format := fmt.Sprintf("%%-%ds %%10s %%8s %%8s %%8s %%8s\n", keyWidth)
+	fmt.Printf(format, header, "Cost", "Tokens", "Hours", "$/h", "Sessions")
+	fmt.Println(strings.Repeat("─", keyWidth+48))
+
+	printRow := func(r ReportRow) {
+		hours, burnRate := "-", "-"
+		if r.seconds > 0 {
+			hours = themes.FormatDuration(time.Duration(r.seconds) * time.Second)
+		}
+		if r.BurnRate > 0 {
+			burnRate = themes.FormatCost(r.BurnRate)
+		}
+		fmt.Printf(format, r.Key, themes.FormatCost(r.Cost), themes.FormatTokens(r.Tokens), hours, burnRate, strconv.Itoa(r.Sessions))
+	}
+	for _, r := range report.Rows {
+		printRow(r)
+	}
+	fmt.Println(strings.Repeat("─", keyWidth+48))
+	printRow(report.Total)
+}
+
+// writeReportCSV prints a report as CSV
+func writeReportCSV(report Report) {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{report.By, "cost", "tokens", "hours", "burn_rate", "sessions"})
+	for _, r := range report.Rows {
+		w.Write([]string{
+			r.Key,
+			strconv.FormatFloat(r.Cost, 'f', 4, 64),
+			strconv.FormatInt(r.Tokens, 10),
+			strconv.FormatFloat(r.Hours, 'f', 2, 64),
+			strconv.FormatFloat(r.BurnRate, 'f', 2, 64),
+			strconv.Itoa(r.Sessions),
+		})
+	}
+	w.Flush()
+}
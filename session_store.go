@@ -0,0 +1,464 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultRetentionDays is how long session files are kept when retention_days is unset
+const defaultRetentionDays = 90
+
+// SessionSummary is the compact form of a session: active seconds per stats day
+type SessionSummary struct {
+	ID      string                  `json:"id"`
+	Project string                  `json:"project,omitempty"`
+	Seconds map[string]int64        `json:"seconds"`          // Day key -> active seconds
+	Ledger  map[string]ledgerAmount `json:"ledger,omitempty"` // Model -> totals recorded in the ledger
+}
+
+// MonthlySummary holds the sessions pruned from one month, by the month of their last activity
+type MonthlySummary struct {
+	Month    string           `json:"month"`
+	Sessions []SessionSummary `json:"sessions"`
+}
+
+// PruneResult counts what a prune removed
+type PruneResult struct {
+	Sessions  int
+	DayFiles  int
+	Cursors   int
+	Ledger    int      // Sessions dropped from the ledger index
+	Summaries []string // Months whose summaries gained sessions
+}
+
+// sessionTrackerDir returns the session-tracker data directory
+func sessionTrackerDir() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".claude", "session-tracker")
+}
+
+// sessionPath returns the file of a session
+func sessionPath(sessionID string) string {
+	return filepath.Join(sessionTrackerDir(), "sessions", sessionID+".json")
+}
+
+// dayIndexPath returns the file listing the sessions active on a stats day
+func dayIndexPath(day string) string {
+	return filepath.Join(sessionTrackerDir(), "days", day+".json")
+}
+
+// summaryPath returns the monthly summary file of pruned sessions
+func summaryPath(month string) string {
+	return filepath.Join(sessionTrackerDir(), "summaries", month+".json")
+}
+
+// summary converts a session into active seconds per day, counted on the day each interval started
+func (s Session) summary() SessionSummary {
+	summary := SessionSummary{ID: s.ID, Project: s.Project, Seconds: make(map[string]int64)}
+	for _, interval := range s.Intervals {
+		if interval.End != nil {
+			summary.Seconds[dayKey(time.Unix(interval.Start, 0))] += *interval.End - interval.Start
+		}
+	}
+	return summary
+}
+
+// readDayIndex reads the session IDs recorded for a stats day
+func readDayIndex(day string) []string {
+	var ids []string
+	if data, err := os.ReadFile(dayIndexPath(day)); err == nil {
+		json.Unmarshal(data, &ids)
+	}
+	return ids
+}
+
+// addToDayIndex records that a session was active on a stats day
+func addToDayIndex(day, sessionID string) {
+	for _, id := range readDayIndex(day) {
+		if id == sessionID {
+			return
+		}
+	}
+
+	path := dayIndexPath(day)
+	os.MkdirAll(filepath.Dir(path), 0755)
+	withFileLock(path, func() {
+		ids := readDayIndex(day)
+		for _, id := range ids {
+			if id == sessionID {
+				return
+			}
+		}
+		if data, err := json.Marshal(append(ids, sessionID)); err == nil {
+			writeFileAtomic(path, data, 0644)
+		}
+	})
+}
+
+// dayIndexMarker returns the file marking that the day index covers every session file
+func dayIndexMarker() string {
+	return filepath.Join(sessionTrackerDir(), "days", ".complete")
+}
+
+// ensureDayIndex builds the day index from the existing session files once, so
+// sessions recorded before the index existed are still found after an upgrade
+func ensureDayIndex() {
+	marker := dayIndexMarker()
+	if _, err := os.Stat(marker); err == nil {
+		return
+	}
+	withFileLock(marker, func() {
+		if _, err := os.Stat(marker); err == nil {
+			return
+		}
+		for _, session := range loadSessions() {
+			indexSessionDays(session)
+		}
+		writeFileAtomic(marker, nil, 0644)
+	})
+}
+
+// indexSessionDays adds a session to the day index of every day it was active on
+func indexSessionDays(session Session) {
+	days := session.summary().Seconds
+	for _, interval := range session.Intervals {
+		days[dayKey(time.Unix(interval.Start, 0))] += 0
+	}
+	if session.Date != "" {
+		days[session.Date] += 0
+	}
+	for day := range days {
+		addToDayIndex(day, session.ID)
+	}
+}
+
+// loadSession reads a session file
+func loadSession(sessionID string) (Session, bool) {
+	data, err := os.ReadFile(sessionPath(sessionID))
+	if err != nil {
+		return Session{}, false
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return Session{}, false
+	}
+	return session, true
+}
+
+// loadDaySessions reads the sessions active on stats days in [fromDay, toDay),
+// using the day index instead of scanning every session file
+func loadDaySessions(fromDay, toDay string) []Session {
+	ensureDayIndex()
+
+	seen := make(map[string]bool)
+	var sessions []Session
+	for day := fromDay; day < toDay; day = shiftDayKey(day, 1) {
+		for _, id := range readDayIndex(day) {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if session, ok := loadSession(id); ok {
+				sessions = append(sessions, session)
+			}
+		}
+	}
+	return sessions
+}
+
+// ActiveInterval is one stretch of activity in a session
+type ActiveInterval struct {
+	Session string
+	Project string
+	Day     string // Stats day the interval started on
+	Start   int64
+	End     int64
+}
+
+// SessionIndex is the activity of the sessions on a range of stats days,
+// read in one pass for every render-time metric
+type SessionIndex struct {
+	DaySeconds     map[string]int64            // Day -> active seconds across sessions
+	ProjectSeconds map[string]map[string]int64 // Project -> day -> active seconds
+	Intervals      []ActiveInterval            // Intervals started within the range, by start time
+}
+
+// loadSessionIndex reads the sessions active on stats days in [fromDay, toDay)
+// and indexes their intervals that started within the range
+func loadSessionIndex(fromDay, toDay string) SessionIndex {
+	idx := SessionIndex{
+		DaySeconds:     make(map[string]int64),
+		ProjectSeconds: make(map[string]map[string]int64),
+	}
+	for _, session := range loadDaySessions(fromDay, toDay) {
+		for _, interval := range session.Intervals {
+			if interval.End == nil {
+				continue
+			}
+			day := dayKey(time.Unix(interval.Start, 0))
+			if day < fromDay || day >= toDay {
+				continue
+			}
+
+			seconds := *interval.End - interval.Start
+			idx.DaySeconds[day] += seconds
+			if session.Project != "" {
+				if idx.ProjectSeconds[session.Project] == nil {
+					idx.ProjectSeconds[session.Project] = make(map[string]int64)
+				}
+				idx.ProjectSeconds[session.Project][day] += seconds
+			}
+			idx.Intervals = append(idx.Intervals, ActiveInterval{
+				Session: session.ID,
+				Project: session.Project,
+				Day:     day,
+				Start:   interval.Start,
+				End:     *interval.End,
+			})
+		}
+	}
+	sort.Slice(idx.Intervals, func(i, j int) bool { return idx.Intervals[i].Start < idx.Intervals[j].Start })
+	return idx
+}
+
+// projectSeconds returns a project's active seconds on days in [fromDay, toDay)
+func (idx SessionIndex) projectSeconds(project, fromDay, toDay string) int64 {
+	var total int64
+	for day, seconds := range idx.ProjectSeconds[project] {
+		if day >= fromDay && day < toDay {
+			total += seconds
+		}
+	}
+	return total
+}
+
+// longestFocus returns the longest continuous stretch of activity started on a day.
+// Overlapping intervals of parallel sessions count as one stretch.
+func (idx SessionIndex) longestFocus(day string) time.Duration {
+	var longest, start, end int64
+	inStretch := false
+	for _, interval := range idx.Intervals {
+		if interval.Day != day {
+			continue
+		}
+		if inStretch && interval.Start <= end {
+			end = max(end, interval.End)
+		} else {
+			start, end = interval.Start, interval.End
+			inStretch = true
+		}
+		longest = max(longest, end-start)
+	}
+	return time.Duration(longest) * time.Second
+}
+
+// loadSessions reads all session files
+func loadSessions() []Session {
+	entries, _ := os.ReadDir(filepath.Join(sessionTrackerDir(), "sessions"))
+
+	var sessions []Session
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		if session, ok := loadSession(strings.TrimSuffix(entry.Name(), ".json")); ok {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+// loadMonthlySummary reads the summary of the sessions pruned from a month
+func loadMonthlySummary(month string) MonthlySummary {
+	summary := MonthlySummary{Month: month}
+	if data, err := os.ReadFile(summaryPath(month)); err == nil {
+		json.Unmarshal(data, &summary)
+	}
+	return summary
+}
+
+// prunedLedgerTotals returns the ledger totals a pruned session had recorded,
+// or nil if the session is not in any monthly summary
+func prunedLedgerTotals(sessionID string) map[string]ledgerAmount {
+	files, _ := filepath.Glob(summaryPath("*"))
+	for i := len(files) - 1; i >= 0; i-- {
+		month := strings.TrimSuffix(filepath.Base(files[i]), ".json")
+		for _, session := range loadMonthlySummary(month).Sessions {
+			if session.ID == sessionID && session.Ledger != nil {
+				return session.Ledger
+			}
+		}
+	}
+	return nil
+}
+
+// loadSessionSummaries returns every session's active time: pruned sessions from
+// the monthly summaries followed by the sessions still kept in full
+func loadSessionSummaries() []SessionSummary {
+	var summaries []SessionSummary
+	files, _ := filepath.Glob(summaryPath("*"))
+	sort.Strings(files)
+	for _, file := range files {
+		month := strings.TrimSuffix(filepath.Base(file), ".json")
+		summaries = append(summaries, loadMonthlySummary(month).Sessions...)
+	}
+	for _, session := range loadSessions() {
+		summaries = append(summaries, session.summary())
+	}
+	return summaries
+}
+
+// pruneSessions rolls sessions last active more than retentionDays ago into
+// monthly summaries and deletes their session and cursor files, along with day
+// index files past retention. Summaries are written before anything is deleted,
+// and a session already in a summary is merged day by day keeping the larger
+// figure, so an interrupted prune can simply be run again. Costs live in the
+// ledger and are not pruned; a pruned session's recorded totals move from the
+// ledger index into its summary.
+func pruneSessions(retentionDays int, now time.Time, dryRun bool) PruneResult {
+	var result PruneResult
+	cutoff := dayKey(now.AddDate(0, 0, -retentionDays))
+
+	byMonth := make(map[string][]Session)
+	for _, session := range loadSessions() {
+		day := session.Date
+		if day == "" && session.LastHeartbeat > 0 {
+			day = dayKey(time.Unix(session.LastHeartbeat, 0))
+		}
+		if day != "" && day < cutoff {
+			byMonth[day[:7]] = append(byMonth[day[:7]], session)
+		}
+	}
+
+	var pruned []string
+	var ledger LedgerIndex
+	if !dryRun && len(byMonth) > 0 {
+		ledger = loadLedgerIndex()
+	}
+	for month, sessions := range byMonth {
+		result.Sessions += len(sessions)
+		result.Summaries = append(result.Summaries, month)
+		if dryRun {
+			for _, session := range sessions {
+				if _, err := os.Stat(transcriptCursorPath(session.ID)); err == nil {
+					result.Cursors++
+				}
+			}
+			continue
+		}
+
+		path := summaryPath(month)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		written := false
+		withFileLock(path, func() {
+			summary := loadMonthlySummary(month)
+			for _, session := range sessions {
+				compact := session.summary()
+				compact.Ledger = ledger.Sessions[session.ID]
+				merged := false
+				for i := range summary.Sessions {
+					if summary.Sessions[i].ID != compact.ID {
+						continue
+					}
+					for day, seconds := range compact.Seconds {
+						summary.Sessions[i].Seconds[day] = max(summary.Sessions[i].Seconds[day], seconds)
+					}
+					if compact.Ledger != nil {
+						summary.Sessions[i].Ledger = compact.Ledger
+					}
+					merged = true
+				}
+				if !merged {
+					summary.Sessions = append(summary.Sessions, compact)
+				}
+			}
+			if data, err := json.Marshal(summary); err == nil {
+				written = writeFileAtomic(path, data, 0644) == nil
+			}
+		})
+		if !written {
+			continue
+		}
+
+		for _, session := range sessions {
+			pruned = append(pruned, session.ID)
+			os.Remove(sessionPath(session.ID))
+			if os.Remove(transcriptCursorPath(session.ID)) == nil {
+				result.Cursors++
+			}
+		}
+	}
+	sort.Strings(result.Summaries)
+
+	if !dryRun && len(pruned) > 0 {
+		result.Ledger = forgetLedgerSessions(pruned)
+	}
+
+	dayFiles, _ := filepath.Glob(dayIndexPath("*"))
+	for _, file := range dayFiles {
+		if strings.TrimSuffix(filepath.Base(file), ".json") < cutoff {
+			result.DayFiles++
+			if !dryRun {
+				os.Remove(file)
+			}
+		}
+	}
+	return result
+}
+
+// retentionDays returns the configured session retention
+func (c Config) retentionDays() int {
+	if c.RetentionDays > 0 {
+		return c.RetentionDays
+	}
+	return defaultRetentionDays
+}
+
+// autoPrune applies the retention policy at most once a day
+func autoPrune(config Config) {
+	marker := filepath.Join(sessionTrackerDir(), "last-prune")
+	if info, err := os.Stat(marker); err == nil && time.Since(info.ModTime()) < 24*time.Hour {
+		return
+	}
+
+	withFileLock(marker, func() {
+		if info, err := os.Stat(marker); err == nil && time.Since(info.ModTime()) < 24*time.Hour {
+			return
+		}
+		pruneSessions(config.retentionDays(), time.Now(), false)
+		writeFileAtomic(marker, nil, 0644)
+	})
+}
+
+// runPrune handles the prune subcommand
+func runPrune(args []string) {
+	config := loadConfig()
+	applyConfig(config)
+
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	days := flags.Int("days", config.retentionDays(), "Keep session detail for this many days")
+	dryRun := flags.Bool("dry-run", false, "Show what would be pruned without changing anything")
+	flags.Parse(args)
+
+	if *days < 1 {
+		fmt.Fprintln(os.Stderr, "--days must be at least 1")
+		os.Exit(1)
+	}
+
+	result := pruneSessions(*days, time.Now(), *dryRun)
+	verb := "Pruned"
+	if *dryRun {
+		verb = "Would prune"
+	}
+	fmt.Printf("%s %d sessions older than %d days into %d monthly summaries, %d day index files, %d transcript cursors\n",
+		verb, result.Sessions, *days, len(result.Summaries), result.DayFiles, result.Cursors)
+	if !*dryRun {
+		fmt.Printf("Dropped %d sessions from the ledger index\n", result.Ledger)
+	}
+}
@@ -2,11 +2,15 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -27,42 +31,28 @@ var (
 	Date    = "unknown"
 )
 
-// Model pricing (per 1M tokens)
-var modelPricing = map[string]struct {
-	Input      float64
-	Output     float64
-	CacheRead  float64
-	CacheWrite float64
-}{
-	"Opus": {
-		Input:      5.0,  // Opus 4.5: $5 per 1M input tokens
-		Output:     25.0, // Opus 4.5: $25 per 1M output tokens
-		CacheRead:  0.5,  // Opus 4.5: $0.50 per 1M cache read tokens
-		CacheWrite: 6.25, // Opus 4.5: $6.25 per 1M cache write tokens (5m)
-	},
-	"Sonnet": {
-		Input:      3.0,  // Sonnet 4/4.5: $3 per 1M input tokens
-		Output:     15.0, // Sonnet 4/4.5: $15 per 1M output tokens
-		CacheRead:  0.3,  // Sonnet 4/4.5: $0.30 per 1M cache read tokens
-		CacheWrite: 3.75, // Sonnet 4/4.5: $3.75 per 1M cache write tokens (5m)
-	},
-	"Haiku": {
-		Input:      1.0,  // Haiku 4.5: $1 per 1M input tokens
-		Output:     5.0,  // Haiku 4.5: $5 per 1M output tokens
-		CacheRead:  0.1,  // Haiku 4.5: $0.10 per 1M cache read tokens
-		CacheWrite: 1.25, // Haiku 4.5: $1.25 per 1M cache write tokens (5m)
-	},
-}
-
 // Input data structure
 type Input struct {
 	Model struct {
+		ID          string `json:"id"`
 		DisplayName string `json:"display_name"`
 	} `json:"model"`
 	SessionID string `json:"session_id"`
 	Workspace struct {
 		CurrentDir string `json:"current_dir"`
+		ProjectDir string `json:"project_dir"`
 	} `json:"workspace"`
+	Version     string `json:"version"`
+	OutputStyle struct {
+		Name string `json:"name"`
+	} `json:"output_style"`
+	Cost struct {
+		TotalCostUSD       float64 `json:"total_cost_usd"`
+		TotalDurationMS    int64   `json:"total_duration_ms"`
+		TotalAPIDurationMS int64   `json:"total_api_duration_ms"`
+		TotalLinesAdded    int     `json:"total_lines_added"`
+		TotalLinesRemoved  int     `json:"total_lines_removed"`
+	} `json:"cost"`
 	TranscriptPath string `json:"transcript_path,omitempty"`
 	ContextWindow  struct {
 		ContextWindowSize int `json:"context_window_size"`
@@ -74,14 +64,77 @@ type Input struct {
 
 // Config structure
 type Config struct {
-	Theme    string `json:"theme"`
-	UsageAPI string `json:"usage_api,omitempty"` // "oauth_usage" (default) or "haiku_probe"
+	Theme       string                `json:"theme"`
+	UsageAPI    string                `json:"usage_api,omitempty"`     // "oauth_usage" (default) or "haiku_probe"
+	APICacheTTL int                   `json:"api_cache_ttl,omitempty"` // Seconds before cached API usage is refreshed; default 300
+	APIBaseURL  string                `json:"api_base_url,omitempty"`  // Usage API gateway; default https://api.anthropic.com
+	Pricing     map[string]ModelPrice `json:"pricing,omitempty"`       // Model-ID pattern -> price per 1M tokens
+
+	// CostSource selects the session cost: "transcript" (default, computed from the
+	// transcript) or "official" (Claude Code's cost.total_cost_usd)
+	CostSource string `json:"cost_source,omitempty"`
+
+	// APIExtrasLine adds a line with the API status, Opus limit and forecasts
+	// to themes that don't show them
+	APIExtrasLine bool `json:"api_extras_line,omitempty"`
+
+	Budget *BudgetConfig `json:"budget,omitempty"` // Spend limits and threshold alerts
+
+	// Stats clock: when days and weeks begin for all stats, sessions and reports
+	Timezone     string `json:"timezone,omitempty"`       // IANA name such as "UTC"; default local time
+	DayStartHour int    `json:"day_start_hour,omitempty"` // 0-23; e.g. 4 counts work until 4am to the previous day
+	WeekStart    string `json:"week_start,omitempty"`     // Weekday name; default "monday"
+
+	RetentionDays int `json:"retention_days,omitempty"` // Days of session detail to keep; default 90
+
+	// Active time: a pause longer than IdleGap seconds (default 600) ends an interval.
+	// ActivitySource "heartbeat" (default) times statusline renders; "transcript"
+	// times user prompts and assistant responses in the session transcript.
+	IdleGap        int    `json:"idle_gap,omitempty"`
+	ActivitySource string `json:"activity_source,omitempty"`
+
+	TimesheetMergeGap int `json:"timesheet_merge_gap,omitempty"` // Seconds between intervals merged into one timesheet entry
 }
 
+// applyConfig installs the settings that package-level helpers read
+func applyConfig(config Config) {
+	setPricingConfig(config.Pricing)
+	setClockConfig(config.Timezone, config.DayStartHour, config.WeekStart)
+
+	sessionIdleGap = defaultIdleGap
+	if config.IdleGap > 0 {
+		sessionIdleGap = int64(config.IdleGap)
+	}
+}
+
+// budget returns the budget configuration, empty when none is set
+func (c Config) budget() BudgetConfig {
+	if c.Budget == nil {
+		return BudgetConfig{}
+	}
+	return *c.Budget
+}
+
+// Session cost sources
+const (
+	costSourceTranscript = "transcript"
+	costSourceOfficial   = "official"
+)
+
+// defaultIdleGap is the default pause in seconds after which activity starts a new interval
+const defaultIdleGap = 600
+
+// sessionIdleGap is the configured idle gap, see Config.IdleGap
+var sessionIdleGap int64 = defaultIdleGap
+
+// activitySourceTranscript times session intervals from the transcript instead of statusline heartbeats
+const activitySourceTranscript = "transcript"
+
 // Session data structure
 type Session struct {
 	ID            string     `json:"id"`
 	Date          string     `json:"date"`
+	Project       string     `json:"project,omitempty"`
 	Start         int64      `json:"start"`
 	LastHeartbeat int64      `json:"last_heartbeat"`
 	TotalSeconds  int64      `json:"total_seconds"`
@@ -102,16 +155,17 @@ type UsageStats struct {
 	LastUpdated  int64              `json:"last_updated"`
 }
 
-// APIUsage structure
+// APILimit is one rate limit bucket of the usage API
+type APILimit struct {
+	Utilization float64 `json:"utilization"` // Percent used
+	ResetsAt    string  `json:"resets_at"`
+	ExhaustsAt  string  `json:"exhausts_at,omitempty"` // Projected time of reaching 100%, from the usage history
+}
+
+// APIUsage holds the rate limit buckets reported by the usage API by name,
+// e.g. five_hour, seven_day and seven_day_opus
 type APIUsage struct {
-	FiveHour struct {
-		Utilization float64 `json:"utilization"`
-		ResetsAt    string  `json:"resets_at"`
-	} `json:"five_hour"`
-	SevenDay struct {
-		Utilization float64 `json:"utilization"`
-		ResetsAt    string  `json:"resets_at"`
-	} `json:"seven_day"`
+	Limits map[string]APILimit `json:"limits"`
 }
 
 // Result channel data
@@ -129,19 +183,46 @@ type GitInfo struct {
 
 // SessionUsageResult contains session usage information
 type SessionUsageResult struct {
-	InputTokens      int64
-	OutputTokens     int64
-	CacheReadTokens  int64
-	CacheWriteTokens int64
-	Cost             float64
-	MessageCount     int
-	Duration         time.Duration
+	InputTokens        int64
+	OutputTokens       int64
+	CacheReadTokens    int64
+	CacheWriteTokens   int64
+	CacheWrite1hTokens int64 // Part of CacheWriteTokens written to the 1-hour cache
+	Cost               float64
+	MessageCount       int
+	Duration           time.Duration
+	Models             map[string]ModelUsage // Per-model breakdown, keyed by model type
+	LastPromptTokens   int64                 // Prompt size of the latest main-thread request
+
+	// Task subagent (sidechain) usage, kept apart from the main thread
+	Subagents      ModelUsage
+	SubagentModels map[string]ModelUsage
+	SubagentCount  int
+
+	// Activity is the session's active intervals derived from transcript timestamps
+	Activity []Interval
+}
+
+// ModelUsage contains the token and cost totals attributed to a single model
+type ModelUsage struct {
+	InputTokens        int64   `json:"input_tokens"`
+	OutputTokens       int64   `json:"output_tokens"`
+	CacheReadTokens    int64   `json:"cache_read_tokens"`
+	CacheWriteTokens   int64   `json:"cache_write_tokens"`
+	CacheWrite1hTokens int64   `json:"cache_write_1h_tokens,omitempty"`
+	Cost               float64 `json:"cost"`
 }
 
 // APIUsageCache wraps APIUsage with a timestamp for file-based caching.
 type APIUsageCache struct {
-	Usage    APIUsage  `json:"usage"`
-	CachedAt time.Time `json:"cached_at"`
+	Usage     APIUsage  `json:"usage"`
+	CachedAt  time.Time `json:"cached_at"`            // When Usage was fetched
+	CheckedAt time.Time `json:"checked_at,omitempty"` // Last refresh attempt, successful or not
+	Status    string    `json:"status,omitempty"`     // Outcome of the last refresh attempt, a themes.APIStatus* value
+
+	// Most recent failed refresh, kept after later successes for --doctor
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at"`
 }
 
 func main() {
@@ -151,14 +232,39 @@ func main() {
 	setTheme := flag.String("set-theme", "", "Set theme")
 	menuMode := flag.Bool("menu", false, "Interactive theme menu")
 	showVersion := flag.Bool("version", false, "Show version information")
+	doctor := flag.Bool("doctor", false, "Check the usage API setup and show the last API error")
+	rebuildStatsMode := flag.Bool("rebuild-stats", false, "Rebuild cost stats and session files from Claude Code transcripts")
+	since := flag.String("since", "", "With --rebuild-stats, only rebuild from this date (YYYY-MM-DD)")
+	dryRun := flag.Bool("dry-run", false, "With --rebuild-stats, show the rebuilt totals without writing")
 	flag.Parse()
 
+	// Subcommands
+	switch flag.Arg(0) {
+	case "report":
+		runReport(flag.Args()[1:])
+		return
+	case "prune":
+		runPrune(flag.Args()[1:])
+		return
+	case "timesheet":
+		runTimesheet(flag.Args()[1:])
+		return
+	case refreshAPIUsageCommand:
+		refreshAPIUsage(loadConfig())
+		return
+	}
+
 	// Process command line arguments
 	if *showVersion {
 		fmt.Printf("statusline %s (commit: %s, built: %s)\n", Version, Commit, Date)
 		return
 	}
 
+	if *doctor {
+		runDoctor()
+		return
+	}
+
 	if *listThemes {
 		printThemeList()
 		return
@@ -179,6 +285,11 @@ func main() {
 		return
 	}
 
+	if *rebuildStatsMode {
+		runRebuildStats(*since, *dryRun)
+		return
+	}
+
 	// Normal mode: read stdin and output statusline
 	var input Input
 	if err := json.NewDecoder(os.Stdin).Decode(&input); err != nil {
@@ -186,15 +297,31 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Apply user pricing and stats clock settings
+	config := loadConfig()
+	applyConfig(config)
+
 	// Get model type
 	modelType := getModelType(input.Model.DisplayName)
 
+	// Project the session's time and cost are attributed to
+	project := projectDir(input)
+
 	// Collect data in parallel
-	data := collectData(input, modelType)
+	data, sessionUsage := collectData(input, modelType, project, config)
 
 	// Update session and stats
-	updateSession(input.SessionID)
-	updateDailyStats(input.SessionID, data, modelType)
+	var activity []Interval
+	if config.ActivitySource == activitySourceTranscript {
+		activity = sessionUsage.Activity
+	}
+	updateSession(input.SessionID, project, activity)
+	// Budgets were computed from the ledger before this render's cost was recorded
+	if recorded := updateLedger(input.SessionID, project, data, sessionUsage); recorded > 0 {
+		data.Budgets, data.BudgetLevel = addBudgetSpend(config.budget(), data.Budgets, recorded)
+	}
+	fireBudgetAlerts(config.budget(), data.Budgets, time.Now())
+	autoPrune(config)
 
 	// Load theme config
 	themeName := loadThemeConfig()
@@ -205,7 +332,7 @@ func main() {
 	}
 
 	// Render output
-	fmt.Print(theme.Render(data))
+	fmt.Print(themes.Render(theme, data))
 }
 
 // printThemeList lists all available themes
@@ -273,18 +400,45 @@ func runInteractiveMenu() {
 		TokenCount:      45200,
 		MessageCount:    12,
 		SessionTime:     "1h30m",
+		LongestFocus:    48 * time.Minute,
 		CacheHitRate:    78,
 		SessionCost:     0.12,
+		ModelCosts:      []themes.ModelCost{{Model: "Opus", Cost: 0.10}, {Model: "Haiku", Cost: 0.02}},
+		SubagentCost:    0.05,
+		SubagentTokens:  8300,
+		SubagentCount:   2,
+		LinesAdded:      120,
+		LinesRemoved:    45,
+		LinesPerDollar:  1375,
+		WallTime:        90 * time.Minute,
+		APITime:         31 * time.Minute,
+		APITimePercent:  34,
 		DayCost:         3.45,
 		MonthCost:       67.89,
 		WeekCost:        23.45,
 		BurnRate:        5.2,
-		ContextUsed:     90000,
-		ContextPercent:  45,
-		API5hrPercent:   23,
-		API5hrTimeLeft:  "3h17m",
-		API7dayPercent:  67,
-		API7dayTimeLeft: "2d5h",
+		ProjectDayCost:  1.80,
+		ProjectWeekCost: 9.60,
+		ProjectDayTime:  50 * time.Minute,
+		ProjectWeekTime: 4*time.Hour + 10*time.Minute,
+		Budgets: []themes.BudgetUsage{
+			{Period: "day", Spent: 3.45, Limit: 20, Percent: 17},
+			{Period: "week", Spent: 23.45, Limit: 100, Percent: 23},
+			{Period: "week", Project: "~/cookys/project", Spent: 9.60, Limit: 12, Percent: 80},
+		},
+		BudgetLevel:             themes.BudgetWarn,
+		ContextUsed:             90000,
+		ContextPercent:          45,
+		API5hrPercent:           23,
+		API5hrTimeLeft:          "3h17m",
+		API7dayPercent:          67,
+		API7dayTimeLeft:         "2d5h",
+		API7dayProjectedExhaust: "1d20h",
+		APILimits: map[string]themes.APILimit{
+			themes.LimitFiveHour:     {Percent: 23, TimeLeft: "3h17m"},
+			themes.LimitSevenDay:     {Percent: 67, TimeLeft: "2d5h", Exhaust: "1d20h"},
+			themes.LimitSevenDayOpus: {Percent: 41, TimeLeft: "2d5h"},
+		},
 	}
 
 	// Print function (raw mode requires \r\n)
@@ -315,7 +469,7 @@ func runInteractiveMenu() {
 		println(strings.Repeat("─", 100))
 
 		// Preview (replace \n with \r\n)
-		preview := themeList[selectedIndex].Render(testData)
+		preview := themes.Render(themeList[selectedIndex], testData)
 		preview = strings.ReplaceAll(preview, "\n", "\r\n")
 		fmt.Print(preview)
 
@@ -406,24 +560,51 @@ func previewThemeDemo(themeName string) {
 		TokenCount:      45200,
 		MessageCount:    12,
 		SessionTime:     "1h30m",
+		LongestFocus:    48 * time.Minute,
 		CacheHitRate:    78,
 		SessionCost:     0.12,
+		ModelCosts:      []themes.ModelCost{{Model: "Opus", Cost: 0.10}, {Model: "Haiku", Cost: 0.02}},
+		SubagentCost:    0.05,
+		SubagentTokens:  8300,
+		SubagentCount:   2,
+		LinesAdded:      120,
+		LinesRemoved:    45,
+		LinesPerDollar:  1375,
+		WallTime:        90 * time.Minute,
+		APITime:         31 * time.Minute,
+		APITimePercent:  34,
 		DayCost:         3.45,
 		MonthCost:       67.89,
 		WeekCost:        23.45,
 		BurnRate:        5.2,
-		ContextUsed:     90000,
-		ContextPercent:  45,
-		API5hrPercent:   23,
-		API5hrTimeLeft:  "3h17m",
-		API7dayPercent:  67,
-		API7dayTimeLeft: "2d5h",
+		ProjectDayCost:  1.80,
+		ProjectWeekCost: 9.60,
+		ProjectDayTime:  50 * time.Minute,
+		ProjectWeekTime: 4*time.Hour + 10*time.Minute,
+		Budgets: []themes.BudgetUsage{
+			{Period: "day", Spent: 3.45, Limit: 20, Percent: 17},
+			{Period: "week", Spent: 23.45, Limit: 100, Percent: 23},
+			{Period: "week", Project: "~/cookys/project", Spent: 9.60, Limit: 12, Percent: 80},
+		},
+		BudgetLevel:             themes.BudgetWarn,
+		ContextUsed:             90000,
+		ContextPercent:          45,
+		API5hrPercent:           23,
+		API5hrTimeLeft:          "3h17m",
+		API7dayPercent:          67,
+		API7dayTimeLeft:         "2d5h",
+		API7dayProjectedExhaust: "1d20h",
+		APILimits: map[string]themes.APILimit{
+			themes.LimitFiveHour:     {Percent: 23, TimeLeft: "3h17m"},
+			themes.LimitSevenDay:     {Percent: 67, TimeLeft: "2d5h", Exhaust: "1d20h"},
+			themes.LimitSevenDayOpus: {Percent: 41, TimeLeft: "2d5h"},
+		},
 	}
 
 	fmt.Printf("\nPreview theme: %s\n", themeName)
 	fmt.Println(strings.Repeat("─", 60))
 	fmt.Println()
-	fmt.Print(theme.Render(data))
+	fmt.Print(themes.Render(theme, data))
 	fmt.Println()
 }
 
@@ -502,11 +683,11 @@ func getConfigPath() string {
 }
 
 // collectData collects all data
-func collectData(input Input, modelType string) themes.StatusData {
+func collectData(input Input, modelType, project string, config Config) (themes.StatusData, SessionUsageResult) {
 	results := make(chan Result, 10)
 	var wg sync.WaitGroup
 
-	wg.Add(6)
+	wg.Add(5)
 
 	go func() {
 		defer wg.Done()
@@ -516,32 +697,33 @@ func collectData(input Input, modelType string) themes.StatusData {
 
 	go func() {
 		defer wg.Done()
-		totalHours := calculateTotalHours(input.SessionID)
-		results <- Result{"hours", totalHours}
+		// One pass over this week's sessions serves hours, burn rate and project time
+		weekStart, _ := periodRange("week", time.Now())
+		sessionIndex := loadSessionIndex(weekStart, shiftDayKey(dayKey(time.Now()), 1))
+		results <- Result{"sessions", sessionIndex}
 	}()
 
 	go func() {
 		defer wg.Done()
-		sessionUsage := calculateSessionUsage(input.TranscriptPath, input.SessionID, modelType)
+		// Prefer the exact model ID so versioned pricing applies to unattributed entries
+		sessionModel := input.Model.ID
+		if sessionModel == "" {
+			sessionModel = input.Model.DisplayName
+		}
+		sessionUsage := calculateSessionUsage(input.TranscriptPath, input.SessionID, sessionModel)
 		results <- Result{"session_usage", sessionUsage}
 	}()
 
 	go func() {
 		defer wg.Done()
-		weeklyStats := getWeeklyStats()
-		results <- Result{"weekly", weeklyStats}
+		// One read of the ledger index serves every cost total
+		results <- Result{"ledger", loadLedgerIndex()}
 	}()
 
 	go func() {
 		defer wg.Done()
-		dailyStats := getDailyStats()
-		results <- Result{"daily", dailyStats}
-	}()
-
-	go func() {
-		defer wg.Done()
-		apiUsage := fetchAPIUsage()
-		results <- Result{"api_usage", apiUsage}
+		apiState := fetchAPIUsage(config)
+		results <- Result{"api_usage", apiState}
 	}()
 
 	go func() {
@@ -552,27 +734,24 @@ func collectData(input Input, modelType string) themes.StatusData {
 	// Collect results
 	var (
 		gitInfo      GitInfo
-		totalHours   string
+		sessionIndex SessionIndex
 		sessionUsage SessionUsageResult
-		dailyStats   UsageStats
-		weeklyStats  UsageStats
-		apiUsage     *APIUsage
+		ledger       LedgerIndex
+		apiState     APIUsageState
 	)
 
 	for result := range results {
 		switch result.Type {
 		case "git":
 			gitInfo = result.Data.(GitInfo)
-		case "hours":
-			totalHours = result.Data.(string)
+		case "sessions":
+			sessionIndex = result.Data.(SessionIndex)
 		case "session_usage":
 			sessionUsage = result.Data.(SessionUsageResult)
-		case "weekly":
-			weeklyStats = result.Data.(UsageStats)
-		case "daily":
-			dailyStats = result.Data.(UsageStats)
+		case "ledger":
+			ledger = result.Data.(LedgerIndex)
 		case "api_usage":
-			apiUsage = result.Data.(*APIUsage)
+			apiState = result.Data.(APIUsageState)
 		}
 	}
 
@@ -580,26 +759,49 @@ func collectData(input Input, modelType string) themes.StatusData {
 	contextUsed := input.ContextWindow.TotalInputTokens + input.ContextWindow.TotalOutputTokens
 	contextPercent := input.ContextWindow.UsedPercentage
 
-	// Get monthly stats
-	monthlyStats := getMonthlyStats()
+	// Cost totals for the current periods
+	dailyStats := getDailyStats(ledger)
+	weeklyStats := getWeeklyStats(ledger)
+	monthlyStats := getMonthlyStats(ledger)
+
+	// Active time today and the burn rate over it
+	today := dayKey(time.Now())
+	totalHours := calculateTotalHours(sessionIndex, today)
+	burnRate := calculateBurnRateValue(dailyStats, sessionIndex, today)
+	projectStats := getProjectStats(ledger, project, sessionIndex)
 
-	// Calculate burn rate
-	burnRate := calculateBurnRateValue(dailyStats)
+	// Spend against the configured budgets
+	budgets, budgetLevel := budgetUsage(config.budget(), project, dailyStats.TotalCost, weeklyStats.TotalCost, monthlyStats.TotalCost, projectStats)
 
 	// Get version and update status
-	version, updateAvailable := getVersionInfo()
+	version, updateAvailable := getVersionInfo(input.Version)
 
 	// API data
 	api5hrPercent := 0
 	api5hrTimeLeft := "--"
 	api7dayPercent := 0
 	api7dayTimeLeft := "--"
-
-	if apiUsage != nil {
-		api5hrPercent = int(apiUsage.FiveHour.Utilization)
-		api5hrTimeLeft = formatTimeLeftShort(apiUsage.FiveHour.ResetsAt)
-		api7dayPercent = int(apiUsage.SevenDay.Utilization)
-		api7dayTimeLeft = formatTimeLeftShort(apiUsage.SevenDay.ResetsAt)
+	var api5hrExhaust, api7dayExhaust string
+	var apiLimits map[string]themes.APILimit
+
+	if apiUsage := apiState.Usage; apiUsage != nil {
+		apiLimits = make(map[string]themes.APILimit, len(apiUsage.Limits))
+		for name, limit := range apiUsage.Limits {
+			apiLimit := themes.APILimit{
+				Percent:  int(limit.Utilization),
+				TimeLeft: formatTimeLeftShort(limit.ResetsAt),
+			}
+			if limit.ExhaustsAt != "" {
+				apiLimit.Exhaust = formatTimeLeftShort(limit.ExhaustsAt)
+			}
+			apiLimits[name] = apiLimit
+		}
+		if limit, ok := apiLimits[themes.LimitFiveHour]; ok {
+			api5hrPercent, api5hrTimeLeft, api5hrExhaust = limit.Percent, limit.TimeLeft, limit.Exhaust
+		}
+		if limit, ok := apiLimits[themes.LimitSevenDay]; ok {
+			api7dayPercent, api7dayTimeLeft, api7dayExhaust = limit.Percent, limit.TimeLeft, limit.Exhaust
+		}
 	}
 
 	// Calculate cache hit rate
@@ -609,44 +811,140 @@ func collectData(input Input, modelType string) themes.StatusData {
 		cacheHitRate = int(float64(sessionUsage.CacheReadTokens) * 100.0 / float64(totalInput))
 	}
 
+	sessionCost, costSource := chooseSessionCost(config.CostSource, sessionUsage.Cost, input.Cost.TotalCostUSD)
+
+	linesPerDollar, apiTimePercent := churnMetrics(input.Cost.TotalLinesAdded, input.Cost.TotalLinesRemoved,
+		sessionCost, input.Cost.TotalDurationMS, input.Cost.TotalAPIDurationMS)
+
 	return themes.StatusData{
 		ModelName:       formatModelName(input.Model.DisplayName),
 		ModelType:       modelType,
 		Version:         version,
 		UpdateAvailable: updateAvailable,
+		OutputStyle:     input.OutputStyle.Name,
 		ProjectPath:     formatProjectPath(input.Workspace.CurrentDir),
+		ProjectDir:      formatProjectPath(project),
 		GitBranch:       gitInfo.Branch,
 		GitStaged:       gitInfo.StagedCount,
 		GitDirty:        gitInfo.DirtyCount,
 		TokenCount:      sessionUsage.InputTokens + sessionUsage.OutputTokens + sessionUsage.CacheReadTokens + sessionUsage.CacheWriteTokens,
 		MessageCount:    sessionUsage.MessageCount,
 		SessionTime:     totalHours,
+		LongestFocus:    sessionIndex.longestFocus(today),
 		CacheHitRate:    cacheHitRate,
-		SessionCost:     sessionUsage.Cost,
+		SessionCost:     sessionCost,
+		CostSource:      costSource,
+		OfficialCost:    input.Cost.TotalCostUSD,
+		ModelCosts:      modelCostBreakdown(sessionUsage.Models),
+		SubagentCost:    sessionUsage.Subagents.Cost,
+		SubagentTokens:  sessionUsage.Subagents.Tokens(),
+		SubagentCount:   sessionUsage.SubagentCount,
+		LongContext:     sessionUsage.LastPromptTokens > longContextThreshold,
+		LinesAdded:      input.Cost.TotalLinesAdded,
+		LinesRemoved:    input.Cost.TotalLinesRemoved,
+		LinesPerDollar:  linesPerDollar,
+		WallTime:        time.Duration(input.Cost.TotalDurationMS) * time.Millisecond,
+		APITime:         time.Duration(input.Cost.TotalAPIDurationMS) * time.Millisecond,
+		APITimePercent:  apiTimePercent,
 		DayCost:         dailyStats.TotalCost,
 		MonthCost:       monthlyStats.TotalCost,
 		WeekCost:        weeklyStats.TotalCost,
 		BurnRate:        burnRate,
+		ProjectDayCost:  projectStats.DayCost,
+		ProjectWeekCost: projectStats.WeekCost,
+		ProjectDayTime:  projectStats.DayTime,
+		ProjectWeekTime: projectStats.WeekTime,
 		ContextUsed:     contextUsed,
 		ContextPercent:  contextPercent,
 		API5hrPercent:   api5hrPercent,
 		API5hrTimeLeft:  api5hrTimeLeft,
 		API7dayPercent:  api7dayPercent,
 		API7dayTimeLeft: api7dayTimeLeft,
+		APILimits:       apiLimits,
+
+		API5hrProjectedExhaust:  api5hrExhaust,
+		API7dayProjectedExhaust: api7dayExhaust,
+		APIStatus:               apiState.Status,
+		APICacheAge:             apiState.Age,
+		ShowAPIExtras:           config.APIExtrasLine,
+		Budgets:                 budgets,
+		BudgetLevel:             budgetLevel,
+	}, sessionUsage
+}
+
+// chooseSessionCost returns the session cost and where it came from: computed
+// from the transcript by default, or Claude Code's own figure with cost_source
+// "official" when it reports one
+func chooseSessionCost(source string, transcriptCost, officialCost float64) (float64, string) {
+	if source == costSourceOfficial && officialCost > 0 {
+		return officialCost, costSourceOfficial
 	}
+	return transcriptCost, costSourceTranscript
 }
 
-// getVersionInfo gets version information
-func getVersionInfo() (string, bool) {
-	// Try to execute claude --version
-	cmd := exec.Command("claude", "--version")
-	output, err := cmd.Output()
+// churnMetrics returns the lines changed per dollar of session cost and the
+// share of wall time spent waiting on the API; each is 0 when its divisor is
+func churnMetrics(linesAdded, linesRemoved int, cost float64, durationMS, apiDurationMS int64) (float64, int) {
+	linesPerDollar := 0.0
+	if cost > 0 {
+		linesPerDollar = float64(linesAdded+linesRemoved) / cost
+	}
+	apiTimePercent := 0
+	if durationMS > 0 {
+		apiTimePercent = int(apiDurationMS * 100 / durationMS)
+	}
+	return linesPerDollar, apiTimePercent
+}
+
+// projectDir returns the project a session belongs to: the git toplevel of the
+// directory Claude Code was launched in, or of the current directory when that
+// is not reported. A session keeps the project recorded in its session file, so
+// git runs once per session rather than on every render.
+func projectDir(input Input) string {
+	if input.SessionID != "" {
+		if session, ok := loadSession(input.SessionID); ok && session.Project != "" {
+			return session.Project
+		}
+	}
+	dir := input.Workspace.ProjectDir
+	if dir == "" {
+		dir = input.Workspace.CurrentDir
+	}
+	return projectRoot(dir)
+}
+
+// projectRoot returns the git toplevel containing dir, or dir itself outside a repository
+func projectRoot(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	output, err := exec.Command("git", "-C", dir, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return dir
+	}
+	if root := strings.TrimSpace(string(output)); root != "" {
+		return filepath.FromSlash(root)
+	}
+	return dir
+}
+
+// getVersionInfo gets version information.
+// The version reported on stdin is used when present, avoiding a `claude --version` call per render.
+func getVersionInfo(stdinVersion string) (string, bool) {
 	version := "v?.?.?"
-	if err == nil {
-		version = strings.TrimSpace(string(output))
-		// Remove extra prefix and suffix
-		version = strings.TrimPrefix(version, "claude ")
-		version = strings.TrimSuffix(version, " (Claude Code)")
+	rawVersion := stdinVersion
+	if rawVersion == "" {
+		// Fall back to executing claude --version
+		cmd := exec.Command("claude", "--version")
+		if output, err := cmd.Output(); err == nil {
+			rawVersion = strings.TrimSpace(string(output))
+			// Remove extra prefix and suffix
+			rawVersion = strings.TrimPrefix(rawVersion, "claude ")
+			rawVersion = strings.TrimSuffix(rawVersion, " (Claude Code)")
+		}
+	}
+	if rawVersion != "" {
+		version = rawVersion
 		if !strings.HasPrefix(version, "v") {
 			version = "v" + version
 		}
@@ -672,14 +970,39 @@ func formatModelName(displayName string) string {
 
 // getModelType gets model type
 func getModelType(displayName string) string {
-	for key := range modelPricing {
-		if strings.Contains(displayName, key) {
-			return key
-		}
+	if modelType, ok := matchModelType(displayName); ok {
+		return modelType
 	}
 	return "Sonnet"
 }
 
+// matchModelType matches a display name or model ID (e.g. "claude-opus-4-1-20250805")
+// against the pricing table and returns the model family
+func matchModelType(name string) (string, bool) {
+	rule, ok := lookupPricing(name)
+	if !ok {
+		return "", false
+	}
+	return rule.Family, true
+}
+
+// modelCostBreakdown converts per-model usage into a cost breakdown, highest cost first
+func modelCostBreakdown(models map[string]ModelUsage) []themes.ModelCost {
+	costs := make([]themes.ModelCost, 0, len(models))
+	for model, usage := range models {
+		if usage.Cost > 0 {
+			costs = append(costs, themes.ModelCost{Model: model, Cost: usage.Cost})
+		}
+	}
+	sort.Slice(costs, func(i, j int) bool {
+		if costs[i].Cost != costs[j].Cost {
+			return costs[i].Cost > costs[j].Cost
+		}
+		return costs[i].Model < costs[j].Model
+	})
+	return costs
+}
+
 // formatProjectPath formats project path
 func formatProjectPath(fullPath string) string {
 	homeDir, err := os.UserHomeDir()
@@ -724,56 +1047,161 @@ func apiUsageCachePath() string {
 	return filepath.Join(homeDir, ".claude", "session-tracker", "api-usage-cache.json")
 }
 
-// fetchAPIUsage fetches API usage using the configured method.
-// Dispatches to haiku probe or oauth usage endpoint based on config.usage_api.
-// Results are cached to a file so that separate process invocations share the same cache.
-func fetchAPIUsage() *APIUsage {
-	cachePath := apiUsageCachePath()
+// defaultAPICacheTTL is how long fetched API usage counts as fresh
+const defaultAPICacheTTL = 5 * time.Minute
 
-	// Try file-based cache first
-	if data, err := os.ReadFile(cachePath); err == nil {
-		var cached APIUsageCache
-		if err := json.Unmarshal(data, &cached); err == nil {
-			if time.Since(cached.CachedAt) < 5*time.Minute {
-				return &cached.Usage
-			}
-		}
+// defaultAPIBaseURL is where API usage is fetched from unless configured otherwise
+const defaultAPIBaseURL = "https://api.anthropic.com"
+
+// apiBaseURL returns the usage API base URL: CLAUDE_STATUSLINE_API_BASE_URL,
+// then api_base_url from the config, then the Anthropic API. The OAuth token is
+// sent there, so only https URLs are accepted, or http to a loopback host.
+func (c Config) apiBaseURL() (string, error) {
+	baseURL := os.Getenv("CLAUDE_STATUSLINE_API_BASE_URL")
+	if baseURL == "" {
+		baseURL = c.APIBaseURL
+	}
+	if baseURL == "" {
+		baseURL = defaultAPIBaseURL
 	}
+	baseURL = strings.TrimRight(baseURL, "/")
 
-	token := getOAuthToken()
-	if token == "" {
-		return nil
+	parsed, err := url.Parse(baseURL)
+	if err != nil || parsed.Host == "" {
+		return "", fmt.Errorf("invalid API base URL %q", baseURL)
 	}
+	if parsed.Scheme != "https" && !(parsed.Scheme == "http" && isLoopbackHost(parsed.Hostname())) {
+		return "", fmt.Errorf("API base URL %q must use https", baseURL)
+	}
+	return baseURL, nil
+}
 
-	config := loadConfig()
-	var usage *APIUsage
-	if config.UsageAPI == "haiku_probe" {
-		usage = fetchViaHaikuProbe(token)
-	} else {
-		usage = fetchViaOAuthUsage(token)
+// isLoopbackHost reports whether host is localhost or a loopback address
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
 	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
 
-	if usage == nil {
-		return nil
+// refreshAPIUsageCommand is the internal subcommand run by the background refresher
+const refreshAPIUsageCommand = "refresh-api-usage"
+
+// apiCacheTTL returns the configured API usage cache lifetime
+func (c Config) apiCacheTTL() time.Duration {
+	if c.APICacheTTL > 0 {
+		return time.Duration(c.APICacheTTL) * time.Second
 	}
+	return defaultAPICacheTTL
+}
 
-	// Write to file cache
-	cached := APIUsageCache{Usage: *usage, CachedAt: time.Now()}
-	if data, err := json.Marshal(cached); err == nil {
-		os.MkdirAll(filepath.Dir(cachePath), 0755)
-		os.WriteFile(cachePath, data, 0644)
+// readAPIUsageCache reads the API usage cache file
+func readAPIUsageCache() (APIUsageCache, bool) {
+	var cached APIUsageCache
+	data, err := os.ReadFile(apiUsageCachePath())
+	if err != nil || json.Unmarshal(data, &cached) != nil {
+		return APIUsageCache{}, false
 	}
+	return cached, true
+}
 
-	return usage
+// fetchAPIUsage returns the cached API usage without waiting for the network,
+// along with the outcome of the last refresh and the age of the data.
+// When the last refresh attempt is older than the cache TTL, a detached
+// refresher process updates the cache for the next render (stale-while-revalidate).
+func fetchAPIUsage(config Config) APIUsageState {
+	cached, ok := readAPIUsageCache()
+	if !ok || time.Since(cached.CheckedAt) >= config.apiCacheTTL() {
+		startAPIUsageRefresh()
+	}
+	if !ok {
+		return APIUsageState{}
+	}
+	return cached.state(config.apiCacheTTL(), time.Now())
+}
+
+// startAPIUsageRefresh launches the background refresher; tests replace it
+var startAPIUsageRefresh = func() {
+	executable, err := os.Executable()
+	if err != nil {
+		return
+	}
+	cmd := exec.Command(executable, refreshAPIUsageCommand)
+	detachProcess(cmd)
+	if cmd.Start() == nil {
+		cmd.Process.Release()
+	}
+}
+
+// refreshAPIUsage fetches API usage using the configured method and updates the
+// cache file. Only one refresher runs at a time across statusline processes;
+// others return at once. A failed fetch keeps the previous usage but still
+// records the attempt and its error, so the API is retried once per TTL rather
+// than per render.
+func refreshAPIUsage(config Config) {
+	cachePath := apiUsageCachePath()
+	tryWithFileLock(cachePath+".refresh", func() {
+		cached, _ := readAPIUsageCache()
+		if time.Since(cached.CheckedAt) < config.apiCacheTTL() {
+			return // Another refresher just finished
+		}
+
+		usage, err := fetchUsage(config)
+		cached.CheckedAt = time.Now()
+		if errors.Is(err, errNoOAuthToken) && cached.CachedAt.IsZero() {
+			// API key users never had a token; there is nothing to warn about
+			cached.Status = ""
+			cached.LastError = err.Error()
+			cached.LastErrorAt = cached.CheckedAt
+		} else if err != nil {
+			cached.Status = apiErrorStatus(err)
+			cached.LastError = err.Error()
+			cached.LastErrorAt = cached.CheckedAt
+		} else {
+			history := recordAPIUsage(*usage, cached.CheckedAt)
+			for name, limit := range usage.Limits {
+				if exhaust := projectExhaustion(history, name, limit); !exhaust.IsZero() {
+					limit.ExhaustsAt = exhaust.Format(time.RFC3339)
+					usage.Limits[name] = limit
+				}
+			}
+			cached.Usage = *usage
+			cached.CachedAt = cached.CheckedAt
+			cached.Status = themes.APIStatusOK
+		}
+		if data, err := json.Marshal(cached); err == nil {
+			writeFileAtomic(cachePath, data, 0644)
+		}
+	})
+}
+
+// errNoOAuthToken is returned by fetchUsage when no Claude Code login is found
+var errNoOAuthToken = &APIError{Status: themes.APIStatusUnauthenticated, Message: "no OAuth token found"}
+
+// fetchUsage fetches API usage now, using the configured method
+func fetchUsage(config Config) (*APIUsage, error) {
+	token := getOAuthToken()
+	if token == "" {
+		return nil, errNoOAuthToken
+	}
+	baseURL, err := config.apiBaseURL()
+	if err != nil {
+		return nil, &APIError{Status: themes.APIStatusError, Message: err.Error()}
+	}
+	if config.UsageAPI == "haiku_probe" {
+		return fetchViaHaikuProbe(baseURL, token)
+	}
+	return fetchViaOAuthUsage(baseURL, token)
 }
 
 // fetchViaHaikuProbe sends a minimal Haiku request and reads rate limit headers.
-func fetchViaHaikuProbe(token string) *APIUsage {
+func fetchViaHaikuProbe(baseURL, token string) (*APIUsage, error) {
 	client := &http.Client{Timeout: 5 * time.Second}
 	body := `{"model":"claude-haiku-4-5-20251001","max_tokens":1,"messages":[{"role":"user","content":"hi"}]}`
-	req, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", strings.NewReader(body))
+	req, err := http.NewRequest("POST", baseURL+"/v1/messages", strings.NewReader(body))
 	if err != nil {
-		return nil
+		return nil, &APIError{Status: themes.APIStatusError, Message: err.Error()}
 	}
 
 	req.Header.Set("Authorization", "Bearer "+token)
@@ -782,41 +1210,47 @@ func fetchViaHaikuProbe(token string) *APIUsage {
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil
+		return nil, &APIError{Status: themes.APIStatusOffline, Message: err.Error()}
 	}
 	defer resp.Body.Close()
 	io.Copy(io.Discard, resp.Body)
 
-	usage := APIUsage{}
-	if v := resp.Header.Get("anthropic-ratelimit-unified-5h-utilization"); v != "" {
-		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			usage.FiveHour.Utilization = f * 100 // header is 0.0-1.0, convert to percent
-		}
-	}
-	if v := resp.Header.Get("anthropic-ratelimit-unified-5h-reset"); v != "" {
-		usage.FiveHour.ResetsAt = v
-	}
-	if v := resp.Header.Get("anthropic-ratelimit-unified-7d-utilization"); v != "" {
-		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			usage.SevenDay.Utilization = f * 100
+	// Rate limited (429) responses still carry the headers
+	usage, ok := usageFromHeaders(resp.Header)
+	if !ok {
+		if err := httpStatusError(resp.StatusCode); err != nil {
+			return nil, err
 		}
+		return nil, &APIError{Status: themes.APIStatusError, Message: "response has no rate limit headers"}
 	}
-	if v := resp.Header.Get("anthropic-ratelimit-unified-7d-reset"); v != "" {
-		usage.SevenDay.ResetsAt = v
-	}
+	return &usage, nil
+}
 
-	if usage.FiveHour.ResetsAt == "" && usage.SevenDay.ResetsAt == "" {
-		return nil
+// usageFromHeaders reads the unified rate limit headers of an API response
+func usageFromHeaders(header http.Header) (APIUsage, bool) {
+	usage := APIUsage{Limits: make(map[string]APILimit)}
+	for window, name := range map[string]string{"5h": themes.LimitFiveHour, "7d": themes.LimitSevenDay} {
+		var limit APILimit
+		if v := header.Get("anthropic-ratelimit-unified-" + window + "-utilization"); v != "" {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				limit.Utilization = f * 100 // header is 0.0-1.0, convert to percent
+			}
+		}
+		limit.ResetsAt = header.Get("anthropic-ratelimit-unified-" + window + "-reset")
+		if limit.ResetsAt != "" {
+			usage.Limits[name] = limit
+		}
 	}
-	return &usage
+	return usage, len(usage.Limits) > 0
 }
 
 // fetchViaOAuthUsage calls the dedicated /api/oauth/usage endpoint.
-func fetchViaOAuthUsage(token string) *APIUsage {
+// Gateways that strip the body but pass the rate limit headers are also supported.
+func fetchViaOAuthUsage(baseURL, token string) (*APIUsage, error) {
 	client := &http.Client{Timeout: 5 * time.Second}
-	req, err := http.NewRequest("GET", "https://api.anthropic.com/api/oauth/usage", nil)
+	req, err := http.NewRequest("GET", baseURL+"/api/oauth/usage", nil)
 	if err != nil {
-		return nil
+		return nil, &APIError{Status: themes.APIStatusError, Message: err.Error()}
 	}
 
 	req.Header.Set("Authorization", "Bearer "+token)
@@ -825,28 +1259,56 @@ func fetchViaOAuthUsage(token string) *APIUsage {
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil
+		return nil, &APIError{Status: themes.APIStatusOffline, Message: err.Error()}
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return nil
+	if err := httpStatusError(resp.StatusCode); err != nil {
+		return nil, err
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil
+		return nil, &APIError{Status: themes.APIStatusOffline, Message: err.Error()}
 	}
 
 	var usage APIUsage
-	if err := json.Unmarshal(body, &usage); err != nil {
-		return nil
+	var ok bool
+	if len(bytes.TrimSpace(body)) == 0 {
+		usage, ok = usageFromHeaders(resp.Header)
+	} else {
+		usage, ok = parseAPIUsage(body)
 	}
+	if !ok {
+		return nil, &APIError{Status: themes.APIStatusError, Message: "unrecognized usage response"}
+	}
+	return &usage, nil
+}
 
-	if usage.FiveHour.ResetsAt == "" && usage.SevenDay.ResetsAt == "" {
-		return nil
+// parseAPIUsage decodes an /api/oauth/usage response. Every field holding an
+// object with a utilization is a limit bucket; null buckets are skipped.
+func parseAPIUsage(body []byte) (APIUsage, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return APIUsage{}, false
+	}
+
+	usage := APIUsage{Limits: make(map[string]APILimit)}
+	for name, raw := range fields {
+		var bucket struct {
+			Utilization *float64 `json:"utilization"`
+			ResetsAt    *string  `json:"resets_at"`
+		}
+		if err := json.Unmarshal(raw, &bucket); err != nil || bucket.Utilization == nil {
+			continue
+		}
+		limit := APILimit{Utilization: *bucket.Utilization}
+		if bucket.ResetsAt != nil {
+			limit.ResetsAt = *bucket.ResetsAt
+		}
+		usage.Limits[name] = limit
 	}
-	return &usage
+	return usage, len(usage.Limits) > 0
 }
 
 // getGitInfo gets Git information
@@ -892,8 +1354,10 @@ func getGitInfo() GitInfo {
 	return result
 }
 
-// updateSession updates session
-func updateSession(sessionID string) {
+// updateSession updates session.
+// By default a render is a heartbeat that extends or starts an interval; when
+// activity intervals derived from the transcript are given, they replace them.
+func updateSession(sessionID, project string, activity []Interval) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return
@@ -904,89 +1368,72 @@ func updateSession(sessionID string) {
 
 	sessionFile := filepath.Join(sessionsDir, sessionID+".json")
 	currentTime := time.Now().Unix()
-	today := time.Now().Format("2006-01-02")
-
-	var session Session
-
-	if data, err := os.ReadFile(sessionFile); err == nil {
-		json.Unmarshal(data, &session)
-		if session.Date != today {
-			session.Date = today
-		}
-	} else {
-		session = Session{
-			ID:            sessionID,
-			Date:          today,
-			Start:         currentTime,
-			LastHeartbeat: currentTime,
-			TotalSeconds:  0,
-			Intervals:     []Interval{{Start: currentTime, End: nil}},
-		}
-	}
+	today := dayKey(time.Now())
 
-	gap := currentTime - session.LastHeartbeat
-	session.LastHeartbeat = currentTime
+	withFileLock(sessionFile, func() {
+		var session Session
 
-	if gap < 600 {
-		if len(session.Intervals) > 0 {
-			session.Intervals[len(session.Intervals)-1].End = &currentTime
+		if data, err := os.ReadFile(sessionFile); err == nil {
+			json.Unmarshal(data, &session)
+			if session.Date != today {
+				session.Date = today
+			}
+		} else {
+			session = Session{
+				ID:            sessionID,
+				Date:          today,
+				Start:         currentTime,
+				LastHeartbeat: currentTime,
+				TotalSeconds:  0,
+				Intervals:     []Interval{{Start: currentTime, End: nil}},
+			}
 		}
-	} else {
-		session.Intervals = append(session.Intervals, Interval{
-			Start: currentTime,
-			End:   &currentTime,
-		})
-	}
 
-	var total int64
-	for _, interval := range session.Intervals {
-		if interval.End != nil {
-			total += *interval.End - interval.Start
+		if project != "" {
+			session.Project = project
 		}
-	}
-	session.TotalSeconds = total
-
-	if data, err := json.Marshal(session); err == nil {
-		os.WriteFile(sessionFile, data, 0644)
-	}
-}
-
-// calculateTotalHours calculates total hours
-func calculateTotalHours(currentSessionID string) string {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return "0m"
-	}
-
-	sessionsDir := filepath.Join(homeDir, ".claude", "session-tracker", "sessions")
-	entries, err := os.ReadDir(sessionsDir)
-	if err != nil {
-		return "0m"
-	}
 
-	var totalSeconds int64
-	today := time.Now().Format("2006-01-02")
+		gap := currentTime - session.LastHeartbeat
+		session.LastHeartbeat = currentTime
 
-	for _, entry := range entries {
-		if !strings.HasSuffix(entry.Name(), ".json") {
-			continue
+		if len(activity) > 0 {
+			session.Intervals = activity
+			session.Start = activity[0].Start
+		} else if gap < sessionIdleGap {
+			if len(session.Intervals) > 0 {
+				session.Intervals[len(session.Intervals)-1].End = &currentTime
+			}
+		} else {
+			session.Intervals = append(session.Intervals, Interval{
+				Start: currentTime,
+				End:   &currentTime,
+			})
 		}
 
-		sessionFile := filepath.Join(sessionsDir, entry.Name())
-		data, err := os.ReadFile(sessionFile)
-		if err != nil {
-			continue
+		var total int64
+		for _, interval := range session.Intervals {
+			if interval.End != nil {
+				total += *interval.End - interval.Start
+			}
 		}
+		session.TotalSeconds = total
 
-		var session Session
-		if err := json.Unmarshal(data, &session); err != nil {
-			continue
+		if data, err := json.Marshal(session); err == nil {
+			writeFileAtomic(sessionFile, data, 0644)
 		}
+	})
 
-		if session.Date == today {
-			totalSeconds += session.TotalSeconds
+	addToDayIndex(today, sessionID)
+	for _, interval := range activity {
+		if day := dayKey(time.Unix(interval.Start, 0)); day != today {
+			addToDayIndex(day, sessionID)
 		}
 	}
+}
+
+// calculateTotalHours calculates total active hours on a day
+func calculateTotalHours(sessions SessionIndex, day string) string {
+	totalSeconds := sessions.DaySeconds[day]
 
 	hours := totalSeconds / 3600
 	minutes := (totalSeconds % 3600) / 60
@@ -997,286 +1444,341 @@ func calculateTotalHours(currentSessionID string) string {
 	return fmt.Sprintf("%dm", minutes)
 }
 
-// calculateSessionUsage calculates session usage
-func calculateSessionUsage(transcriptPath, sessionID, modelType string) SessionUsageResult {
-	result := SessionUsageResult{}
+// transcriptEntry is the subset of a transcript JSONL line used for usage accounting
+type transcriptEntry struct {
+	SessionID   string  `json:"sessionId"`
+	IsSidechain bool    `json:"isSidechain"`
+	ParentUUID  *string `json:"parentUuid"`
+	Type        string  `json:"type"`
+	Timestamp   string  `json:"timestamp"`
+	RequestID   string  `json:"requestId"`
+	CWD         string  `json:"cwd"`
+	Message     struct {
+		ID    string `json:"id"`
+		Model string `json:"model"`
+		Usage *struct {
+			InputTokens              int64 `json:"input_tokens"`
+			OutputTokens             int64 `json:"output_tokens"`
+			CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+			CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+			CacheCreation            *struct {
+				Ephemeral5mInputTokens int64 `json:"ephemeral_5m_input_tokens"`
+				Ephemeral1hInputTokens int64 `json:"ephemeral_1h_input_tokens"`
+			} `json:"cache_creation"`
+		} `json:"usage"`
+	} `json:"message"`
+}
 
+// calculateSessionUsage calculates session usage.
+// Parsing resumes from the session's saved cursor so only newly appended
+// transcript lines are read; a replaced or truncated transcript is rescanned.
+func calculateSessionUsage(transcriptPath, sessionID, sessionModel string) SessionUsageResult {
 	if transcriptPath == "" {
-		return result
+		return SessionUsageResult{}
 	}
 
 	file, err := os.Open(transcriptPath)
 	if err != nil {
-		return result
+		return SessionUsageResult{}
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	const maxScanTokenSize = 1024 * 1024
-	buf := make([]byte, 0, maxScanTokenSize)
-	scanner.Buffer(buf, maxScanTokenSize)
+	info, err := file.Stat()
+	if err != nil {
+		return SessionUsageResult{}
+	}
 
-	var sessionStart time.Time
-	var lastTime time.Time
+	cursor := loadTranscriptCursor(sessionID)
+	if !cursor.resumable(transcriptPath, file, info) || cursor.Pricing != pricingFingerprint() || cursor.IdleGap != sessionIdleGap {
+		cursor = TranscriptCursor{Path: transcriptPath, Pricing: pricingFingerprint(), IdleGap: sessionIdleGap}
+	}
+	startOffset := cursor.Offset
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.TrimSpace(line) == "" {
-			continue
-		}
+	if _, err := file.Seek(cursor.Offset, io.SeekStart); err != nil {
+		return SessionUsageResult{}
+	}
 
-		var data map[string]interface{}
-		if err := json.Unmarshal([]byte(line), &data); err != nil {
-			continue
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// A trailing line without newline is still being written; pick it up next time
+			break
 		}
+		cursor.Offset += int64(len(line))
+		cursor.addLine(line, sessionID, sessionModel)
+	}
 
-		if sid, ok := data["sessionId"].(string); !ok || sid != sessionID {
-			continue
-		}
+	cursor.Inode = fileInode(info)
+	cursor.Size = info.Size()
+	if cursor.Offset != startOffset || startOffset == 0 {
+		saveTranscriptCursor(sessionID, cursor)
+	}
 
-		if isSidechain, ok := data["isSidechain"].(bool); ok && isSidechain {
-			continue
-		}
+	return cursor.result()
+}
 
-		if ts, ok := data["timestamp"].(string); ok {
-			if t, err := time.Parse(time.RFC3339, ts); err == nil {
-				if sessionStart.IsZero() {
-					sessionStart = t
-				}
-				lastTime = t
-			}
+// addLine accumulates one transcript line into the cursor's running totals
+func (c *TranscriptCursor) addLine(line []byte, sessionID, sessionModel string) {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+
+	var entry transcriptEntry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return
+	}
+
+	if entry.SessionID != sessionID {
+		return
+	}
+
+	// Prompts and responses, including subagents', mark the session as active
+	if entry.Type == "user" || entry.Type == "assistant" {
+		if t, err := time.Parse(time.RFC3339, entry.Timestamp); err == nil {
+			c.addActivity(t.Unix())
 		}
+	}
 
-		if msgType, ok := data["type"].(string); ok && msgType == "user" {
-			result.MessageCount++
+	// Task subagents run on sidechains; their spend is tracked apart from the main thread
+	if entry.IsSidechain {
+		if entry.Type == "user" && entry.ParentUUID == nil {
+			c.SubagentCount++
 		}
+		if entryUsage, entryModel, ok := c.entryUsage(entry, sessionModel); ok {
+			cost := calculateRequestCost(entryUsage, entryModel)
+			c.Subagents.add(entryUsage, cost)
+			c.SubagentModels = addModelUsage(c.SubagentModels, getModelType(entryModel), entryUsage, cost)
+		}
+		return
+	}
 
-		if message, ok := data["message"].(map[string]interface{}); ok {
-			if usage, ok := message["usage"].(map[string]interface{}); ok {
-				if input, ok := usage["input_tokens"].(float64); ok {
-					result.InputTokens += int64(input)
-				}
-				if output, ok := usage["output_tokens"].(float64); ok {
-					result.OutputTokens += int64(output)
-				}
-				if cacheRead, ok := usage["cache_read_input_tokens"].(float64); ok {
-					result.CacheReadTokens += int64(cacheRead)
-				}
-				if cacheCreation, ok := usage["cache_creation_input_tokens"].(float64); ok {
-					result.CacheWriteTokens += int64(cacheCreation)
-				}
-			}
+	if t, err := time.Parse(time.RFC3339, entry.Timestamp); err == nil {
+		if c.SessionStart.IsZero() {
+			c.SessionStart = t
 		}
+		c.LastTime = t
 	}
 
-	if !sessionStart.IsZero() && !lastTime.IsZero() {
-		result.Duration = lastTime.Sub(sessionStart)
+	if entry.Type == "user" {
+		c.MessageCount++
 	}
 
-	result.Cost = calculateCost(result, modelType)
+	if entryUsage, entryModel, ok := c.entryUsage(entry, sessionModel); ok {
+		c.LastPromptTokens = promptTokens(entryUsage)
+		c.InputTokens += entryUsage.InputTokens
+		c.OutputTokens += entryUsage.OutputTokens
+		c.CacheReadTokens += entryUsage.CacheReadTokens
+		c.CacheWriteTokens += entryUsage.CacheWriteTokens
+		c.CacheWrite1hTokens += entryUsage.CacheWrite1hTokens
 
-	return result
+		cost := calculateRequestCost(entryUsage, entryModel)
+		c.Cost += cost
+		c.Models = addModelUsage(c.Models, getModelType(entryModel), entryUsage, cost)
+	}
 }
 
-// calculateCost calculates cost
-func calculateCost(usage SessionUsageResult, modelType string) float64 {
-	pricing, ok := modelPricing[modelType]
-	if !ok {
-		pricing = modelPricing["Sonnet"]
+// addActivity extends the activity timeline with a transcript timestamp,
+// starting a new interval after a pause of sessionIdleGap or more
+func (c *TranscriptCursor) addActivity(ts int64) {
+	if n := len(c.Activity); n > 0 && ts-*c.Activity[n-1].End < sessionIdleGap {
+		if ts > *c.Activity[n-1].End {
+			c.Activity[n-1].End = &ts
+		}
+		return
 	}
-
-	cost := float64(usage.InputTokens) * pricing.Input / 1000000
-	cost += float64(usage.OutputTokens) * pricing.Output / 1000000
-	cost += float64(usage.CacheReadTokens) * pricing.CacheRead / 1000000
-	cost += float64(usage.CacheWriteTokens) * pricing.CacheWrite / 1000000
-
-	return cost
+	c.Activity = append(c.Activity, Interval{Start: ts, End: &ts})
 }
 
-
-// getDailyStats gets daily stats
-func getDailyStats() UsageStats {
-	homeDir, _ := os.UserHomeDir()
-	statsDir := filepath.Join(homeDir, ".claude", "session-tracker", "stats")
-	today := time.Now().Format("2006-01-02")
-	statsFile := filepath.Join(statsDir, "daily-"+today+".json")
-
-	var stats UsageStats
-	if data, err := os.ReadFile(statsFile); err == nil {
-		json.Unmarshal(data, &stats)
+// entryUsage extracts the usage of an API response and the model to price it at.
+// It returns false for lines without usage and for repeated lines of a counted response.
+func (c *TranscriptCursor) entryUsage(entry transcriptEntry, sessionModel string) (SessionUsageResult, string, bool) {
+	if entry.Message.Usage == nil || c.seen(entry.Message.ID, entry.RequestID) {
+		return SessionUsageResult{}, "", false
 	}
-	stats.Date = today
-
-	return stats
+	return transcriptUsage(entry, sessionModel)
 }
 
-// getWeeklyStats gets weekly stats
-func getWeeklyStats() UsageStats {
-	homeDir, _ := os.UserHomeDir()
-	statsDir := filepath.Join(homeDir, ".claude", "session-tracker", "stats")
-
-	now := time.Now()
-	weekday := int(now.Weekday())
-	if weekday == 0 {
-		weekday = 7
+// transcriptUsage extracts the usage of an API response line and the model to price it at.
+// It returns false for lines without usage.
+func transcriptUsage(entry transcriptEntry, sessionModel string) (SessionUsageResult, string, bool) {
+	usage := entry.Message.Usage
+	if usage == nil {
+		return SessionUsageResult{}, "", false
 	}
-	weekStart := now.AddDate(0, 0, -(weekday - 1)).Format("2006-01-02")
 
-	statsFile := filepath.Join(statsDir, "weekly-"+weekStart+".json")
-
-	var stats UsageStats
-	if data, err := os.ReadFile(statsFile); err == nil {
-		json.Unmarshal(data, &stats)
+	entryUsage := SessionUsageResult{
+		InputTokens:      usage.InputTokens,
+		OutputTokens:     usage.OutputTokens,
+		CacheReadTokens:  usage.CacheReadInputTokens,
+		CacheWriteTokens: usage.CacheCreationInputTokens,
 	}
-	stats.Week = weekStart
-
-	return stats
-}
-
-// getMonthlyStats gets monthly stats
-func getMonthlyStats() UsageStats {
-	homeDir, _ := os.UserHomeDir()
-	statsDir := filepath.Join(homeDir, ".claude", "session-tracker", "stats")
-
-	monthKey := time.Now().Format("2006-01")
-	statsFile := filepath.Join(statsDir, "monthly-"+monthKey+".json")
 
-	var stats UsageStats
-	if data, err := os.ReadFile(statsFile); err == nil {
-		json.Unmarshal(data, &stats)
+	// Newer transcripts split cache writes into 5-minute and 1-hour tiers
+	if split := usage.CacheCreation; split != nil {
+		if entryUsage.CacheWriteTokens == 0 {
+			entryUsage.CacheWriteTokens = split.Ephemeral5mInputTokens + split.Ephemeral1hInputTokens
+		}
+		entryUsage.CacheWrite1hTokens = min(split.Ephemeral1hInputTokens, entryUsage.CacheWriteTokens)
 	}
 
-	return stats
+	// Price each response at the model that produced it, falling back to the session model
+	entryModel := entry.Message.Model
+	if _, ok := lookupPricing(entryModel); !ok {
+		entryModel = sessionModel
+	}
+	return entryUsage, entryModel, true
 }
 
-// updateDailyStats updates daily stats
-func updateDailyStats(sessionID string, data themes.StatusData, modelType string) {
-	homeDir, _ := os.UserHomeDir()
-	statsDir := filepath.Join(homeDir, ".claude", "session-tracker", "stats")
-	os.MkdirAll(statsDir, 0755)
+// add accumulates one priced API response
+func (u *ModelUsage) add(usage SessionUsageResult, cost float64) {
+	u.InputTokens += usage.InputTokens
+	u.OutputTokens += usage.OutputTokens
+	u.CacheReadTokens += usage.CacheReadTokens
+	u.CacheWriteTokens += usage.CacheWriteTokens
+	u.CacheWrite1hTokens += usage.CacheWrite1hTokens
+	u.Cost += cost
+}
 
-	today := time.Now().Format("2006-01-02")
-	dailyFile := filepath.Join(statsDir, "daily-"+today+".json")
+// Tokens returns the total of all token kinds
+func (u ModelUsage) Tokens() int64 {
+	return u.InputTokens + u.OutputTokens + u.CacheReadTokens + u.CacheWriteTokens
+}
 
-	var dailyStats UsageStats
-	if fileData, err := os.ReadFile(dailyFile); err == nil {
-		json.Unmarshal(fileData, &dailyStats)
+// addModelUsage accumulates a priced API response into a per-model breakdown
+func addModelUsage(models map[string]ModelUsage, model string, usage SessionUsageResult, cost float64) map[string]ModelUsage {
+	if models == nil {
+		models = make(map[string]ModelUsage)
 	}
+	modelUsage := models[model]
+	modelUsage.add(usage, cost)
+	models[model] = modelUsage
+	return models
+}
 
-	if dailyStats.SessionCosts == nil {
-		dailyStats.SessionCosts = make(map[string]float64)
-	}
+// calculateCost calculates cost for a model ID, display name or model type at base rates
+func calculateCost(usage SessionUsageResult, model string) float64 {
+	return usageCost(usage, modelPrice(model))
+}
 
-	lastKnownCost := dailyStats.SessionCosts[sessionID]
-	delta := data.SessionCost - lastKnownCost
-	if delta > 0 {
-		dailyStats.TotalCost += delta
-		dailyStats.SessionCosts[sessionID] = data.SessionCost
+// calculateRequestCost calculates the cost of a single API request. Requests whose
+// prompt exceeds the long-context threshold are billed at the model's long-context rates.
+func calculateRequestCost(usage SessionUsageResult, model string) float64 {
+	pricing := modelPrice(model)
+	if pricing.LongContext != nil && promptTokens(usage) > longContextThreshold {
+		pricing = *pricing.LongContext
 	}
+	return usageCost(usage, pricing)
+}
 
-	dailyStats.Date = today
-	dailyStats.LastUpdated = time.Now().Unix()
+// usageCost applies per-1M-token prices to usage.
+// Cache writes without a 5m/1h split are priced at the 5-minute rate.
+func usageCost(usage SessionUsageResult, pricing ModelPrice) float64 {
+	cacheWrite5m := usage.CacheWriteTokens - usage.CacheWrite1hTokens
 
-	if fileData, err := json.Marshal(dailyStats); err == nil {
-		os.WriteFile(dailyFile, fileData, 0644)
-	}
+	cost := float64(usage.InputTokens) * pricing.Input / 1000000
+	cost += float64(usage.OutputTokens) * pricing.Output / 1000000
+	cost += float64(usage.CacheReadTokens) * pricing.CacheRead / 1000000
+	cost += float64(cacheWrite5m) * pricing.CacheWrite / 1000000
+	cost += float64(usage.CacheWrite1hTokens) * pricing.cacheWrite1h() / 1000000
 
-	updateWeeklyStats(sessionID, data.SessionCost)
-	updateMonthlyStats(sessionID, data.SessionCost)
+	return cost
 }
 
-// updateWeeklyStats updates weekly stats
-func updateWeeklyStats(sessionID string, sessionCost float64) {
-	homeDir, _ := os.UserHomeDir()
-	statsDir := filepath.Join(homeDir, ".claude", "session-tracker", "stats")
-
-	now := time.Now()
-	weekday := int(now.Weekday())
-	if weekday == 0 {
-		weekday = 7
-	}
-	weekStart := now.AddDate(0, 0, -(weekday - 1)).Format("2006-01-02")
+// promptTokens returns the prompt size of a request, including cached input
+func promptTokens(usage SessionUsageResult) int64 {
+	return usage.InputTokens + usage.CacheReadTokens + usage.CacheWriteTokens
+}
 
-	weeklyFile := filepath.Join(statsDir, "weekly-"+weekStart+".json")
+// getDailyStats gets daily stats from the cost ledger index
+func getDailyStats(idx LedgerIndex) UsageStats {
+	today := dayKey(time.Now())
 
-	var weeklyStats UsageStats
-	if data, err := os.ReadFile(weeklyFile); err == nil {
-		json.Unmarshal(data, &weeklyStats)
+	return UsageStats{
+		TotalCost: idx.Days[today].Cost,
+		Date:      today,
 	}
+}
 
-	if weeklyStats.SessionCosts == nil {
-		weeklyStats.SessionCosts = make(map[string]float64)
-	}
+// getWeeklyStats gets weekly stats from the cost ledger index
+func getWeeklyStats(idx LedgerIndex) UsageStats {
+	weekStart, weekEnd := periodRange("week", time.Now())
 
-	lastKnownCost := weeklyStats.SessionCosts[sessionID]
-	delta := sessionCost - lastKnownCost
-	if delta > 0 {
-		weeklyStats.TotalCost += delta
-		weeklyStats.SessionCosts[sessionID] = sessionCost
+	return UsageStats{
+		TotalCost: idx.totalsBetween(weekStart, weekEnd).Cost,
+		Week:      weekStart,
 	}
+}
 
-	weeklyStats.Week = weekStart
-	weeklyStats.LastUpdated = time.Now().Unix()
+// getMonthlyStats gets monthly stats from the cost ledger index
+func getMonthlyStats(idx LedgerIndex) UsageStats {
+	monthStart, monthEnd := periodRange("month", time.Now())
 
-	if data, err := json.Marshal(weeklyStats); err == nil {
-		os.WriteFile(weeklyFile, data, 0644)
+	return UsageStats{
+		TotalCost: idx.totalsBetween(monthStart, monthEnd).Cost,
 	}
 }
 
-// updateMonthlyStats updates monthly stats
-func updateMonthlyStats(sessionID string, sessionCost float64) {
-	homeDir, _ := os.UserHomeDir()
-	statsDir := filepath.Join(homeDir, ".claude", "session-tracker", "stats")
-
-	monthKey := time.Now().Format("2006-01")
-	monthlyFile := filepath.Join(statsDir, "monthly-"+monthKey+".json")
+// ProjectStats holds a project's cost and active time for the current periods
+type ProjectStats struct {
+	DayCost   float64
+	WeekCost  float64
+	MonthCost float64
+	DayTime   time.Duration
+	WeekTime  time.Duration
+}
 
-	var monthlyStats UsageStats
-	if data, err := os.ReadFile(monthlyFile); err == nil {
-		json.Unmarshal(data, &monthlyStats)
+// getProjectStats gets a project's cost for the current day, week and month, and its active time
+func getProjectStats(idx LedgerIndex, project string, sessions SessionIndex) ProjectStats {
+	var stats ProjectStats
+	if project == "" {
+		return stats
 	}
 
-	if monthlyStats.SessionCosts == nil {
-		monthlyStats.SessionCosts = make(map[string]float64)
-	}
+	now := time.Now()
+	today := dayKey(now)
+	weekStart, weekEnd := periodRange("week", now)
+	monthStart, monthEnd := periodRange("month", now)
 
-	lastKnownCost := monthlyStats.SessionCosts[sessionID]
-	delta := sessionCost - lastKnownCost
-	if delta > 0 {
-		monthlyStats.TotalCost += delta
-		monthlyStats.SessionCosts[sessionID] = sessionCost
-	}
+	stats.DayCost = idx.Days[today].Projects[project]
+	stats.WeekCost = idx.totalsBetween(weekStart, weekEnd).Projects[project]
+	stats.MonthCost = idx.totalsBetween(monthStart, monthEnd).Projects[project]
 
-	monthlyStats.LastUpdated = time.Now().Unix()
+	stats.DayTime = time.Duration(sessions.projectSeconds(project, today, shiftDayKey(today, 1))) * time.Second
+	stats.WeekTime = time.Duration(sessions.projectSeconds(project, weekStart, weekEnd)) * time.Second
+	return stats
+}
 
-	if data, err := json.Marshal(monthlyStats); err == nil {
-		os.WriteFile(monthlyFile, data, 0644)
+// updateLedger records the session's cost increase in the cost ledger.
+// Claude Code's official cost already covers subagents and is not split by
+// model, so it is recorded as a session total under the current model.
+func updateLedger(sessionID, project string, data themes.StatusData, usage SessionUsageResult) float64 {
+	if data.CostSource == costSourceOfficial {
+		total := ledgerAmount{Cost: data.SessionCost, Tokens: data.TokenCount + data.SubagentTokens}
+		return appendLedgerSessionTotal(sessionID, project, data.ModelType, total, time.Now())
 	}
+	return appendLedger(sessionID, project, sessionLedgerTotals(usage), time.Now())
 }
 
-// calculateBurnRateValue calculates burn rate value
-func calculateBurnRateValue(dailyStats UsageStats) float64 {
-	homeDir, _ := os.UserHomeDir()
-	sessionsDir := filepath.Join(homeDir, ".claude", "session-tracker", "sessions")
-	entries, _ := os.ReadDir(sessionsDir)
-
-	var totalSeconds int64
-	today := time.Now().Format("2006-01-02")
-
-	for _, entry := range entries {
-		if !strings.HasSuffix(entry.Name(), ".json") {
-			continue
-		}
-
-		sessionFile := filepath.Join(sessionsDir, entry.Name())
-		data, _ := os.ReadFile(sessionFile)
-
-		var session Session
-		if err := json.Unmarshal(data, &session); err == nil && session.Date == today {
-			totalSeconds += session.TotalSeconds
+// sessionLedgerTotals returns the session's cumulative cost and tokens per model
+// from its transcript. Subagent spend is billed to the account like the main
+// thread, so it is included.
+func sessionLedgerTotals(usage SessionUsageResult) map[string]ledgerAmount {
+	totals := make(map[string]ledgerAmount)
+	for _, models := range []map[string]ModelUsage{usage.Models, usage.SubagentModels} {
+		for model, modelUsage := range models {
+			amount := totals[model]
+			amount.Cost += modelUsage.Cost
+			amount.Tokens += modelUsage.Tokens()
+			totals[model] = amount
 		}
 	}
+	return totals
+}
 
+// calculateBurnRateValue calculates burn rate value over a day's active time
+func calculateBurnRateValue(dailyStats UsageStats, sessions SessionIndex, day string) float64 {
+	totalSeconds := sessions.DaySeconds[day]
 	if totalSeconds < 300 {
 		return 0
 	}
@@ -1285,15 +1787,22 @@ func calculateBurnRateValue(dailyStats UsageStats) float64 {
 	return dailyStats.TotalCost / hours
 }
 
+// parseLimitTime parses a rate limit time: Unix epoch seconds (from rate limit
+// headers) or ISO 8601 (from the usage API)
+func parseLimitTime(timeStr string) (time.Time, bool) {
+	if epoch, err := strconv.ParseInt(timeStr, 10, 64); err == nil {
+		return time.Unix(epoch, 0), true
+	}
+	if parsed, err := time.Parse(time.RFC3339, timeStr); err == nil {
+		return parsed, true
+	}
+	return time.Time{}, false
+}
+
 // formatTimeLeftShort formats time left in short form
 func formatTimeLeftShort(timeStr string) string {
-	var t time.Time
-	// Try Unix epoch seconds first (from rate limit headers), then ISO 8601 (from usage API)
-	if epoch, err := strconv.ParseInt(timeStr, 10, 64); err == nil {
-		t = time.Unix(epoch, 0)
-	} else if parsed, err := time.Parse(time.RFC3339, timeStr); err == nil {
-		t = parsed
-	} else {
+	t, ok := parseLimitTime(timeStr)
+	if !ok {
 		return "?"
 	}
 
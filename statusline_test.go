@@ -1,7 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/kevinlincg/claude-statusline/themes"
 )
 
 func TestGetModelType(t *testing.T) {
@@ -14,6 +31,8 @@ func TestGetModelType(t *testing.T) {
 		{"Claude Haiku 3.5", "Haiku"},
 		{"Opus 4.5", "Opus"},
 		{"Sonnet", "Sonnet"},
+		{"claude-opus-4-1-20250805", "Opus"},
+		{"claude-3-5-haiku-20241022", "Haiku"},
 		{"Unknown Model", "Sonnet"}, // Default fallback
 	}
 
@@ -142,6 +161,823 @@ func TestCalculateCost(t *testing.T) {
 	}
 }
 
+func TestLookupPricing(t *testing.T) {
+	tests := []struct {
+		model string
+		input float64
+	}{
+		{"claude-opus-4-5-20251101", 5},
+		{"claude-opus-4-1-20250805", 15},
+		{"claude-opus-4-20250514", 15},
+		{"claude-opus-4-0", 15},
+		{"claude-opus-4-7", 5},
+		{"Claude Opus 4.1", 15},
+		{"Opus 4.6", 5},
+		{"claude-sonnet-4-5-20250929", 3},
+		{"claude-3-5-haiku-20241022", 0.8},
+		{"claude-haiku-4-5-20251001", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			rule, ok := lookupPricing(tt.model)
+			if !ok || rule.Price.Input != tt.input {
+				t.Errorf("lookupPricing(%q) input price = %v, want %v", tt.model, rule.Price.Input, tt.input)
+			}
+		})
+	}
+}
+
+func TestCalculateRequestCostLongContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		usage    SessionUsageResult
+		model    string
+		expected float64
+	}{
+		{"sonnet base", SessionUsageResult{InputTokens: 100000, OutputTokens: 10000}, "claude-sonnet-4-5", 0.45},
+		{"sonnet at threshold", SessionUsageResult{InputTokens: 200000}, "claude-sonnet-4-5", 0.6},
+		// 1K input + 250K cache read pushes the prompt over 200K
+		{"sonnet long context", SessionUsageResult{InputTokens: 1000, CacheReadTokens: 250000, OutputTokens: 10000}, "claude-sonnet-4-5", 0.006 + 0.15 + 0.225},
+		{"haiku has no long-context tier", SessionUsageResult{InputTokens: 300000}, "claude-haiku-4-5", 0.3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := calculateRequestCost(tt.usage, tt.model)
+			if result < tt.expected-0.0001 || result > tt.expected+0.0001 {
+				t.Errorf("calculateRequestCost() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCalculateSessionUsageCacheWriteTiers(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	transcript := filepath.Join(t.TempDir(), "session.jsonl")
+	lines := `{"sessionId":"s1","type":"assistant","message":{"id":"m1","model":"claude-sonnet-4-5","usage":{"input_tokens":0,"output_tokens":0,"cache_creation_input_tokens":30000,"cache_creation":{"ephemeral_5m_input_tokens":10000,"ephemeral_1h_input_tokens":20000}}}}
+{"sessionId":"s1","type":"assistant","message":{"id":"m2","model":"claude-sonnet-4-5","usage":{"input_tokens":0,"output_tokens":0,"cache_creation_input_tokens":10000}}}
+`
+	os.WriteFile(transcript, []byte(lines), 0644)
+
+	result := calculateSessionUsage(transcript, "s1", "Sonnet")
+
+	if result.CacheWriteTokens != 40000 || result.CacheWrite1hTokens != 20000 {
+		t.Errorf("cache writes = %d (1h %d), want 40000 (1h 20000)", result.CacheWriteTokens, result.CacheWrite1hTokens)
+	}
+
+	// 20K at the 5m rate ($3.75) plus 20K at the 1h rate (2 x $3 input)
+	expected := 20000*3.75/1000000 + 20000*6.0/1000000
+	if result.Cost < expected-0.000001 || result.Cost > expected+0.000001 {
+		t.Errorf("Cost = %v, want %v", result.Cost, expected)
+	}
+}
+
+func TestSetPricingConfig(t *testing.T) {
+	defer setPricingConfig(nil)
+
+	setPricingConfig(map[string]ModelPrice{
+		"claude-opus-4-5": {Input: 4, Output: 20},
+		"opus":            {Input: 7, Output: 30},
+	})
+
+	// User rules win over built-ins, and the longest user pattern wins among them
+	if rule, _ := lookupPricing("claude-opus-4-5-20251101"); rule.Price.Input != 4 || rule.Family != "Opus" {
+		t.Errorf("opus 4.5 rule = %+v, want user price 4 and family Opus", rule)
+	}
+	if rule, _ := lookupPricing("claude-opus-4-1-20250805"); rule.Price.Input != 7 {
+		t.Errorf("opus 4.1 input price = %v, want user family override 7", rule.Price.Input)
+	}
+	if rule, _ := lookupPricing("claude-sonnet-4-5"); rule.Price.Input != 3 {
+		t.Errorf("sonnet input price = %v, want built-in 3", rule.Price.Input)
+	}
+}
+
+func TestGetVersionInfoFromStdin(t *testing.T) {
+	tests := []struct {
+		stdinVersion string
+		expected     string
+	}{
+		{"2.0.37", "v2.0.37"},
+		{"v1.0.75", "v1.0.75"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.stdinVersion, func(t *testing.T) {
+			version, _ := getVersionInfo(tt.stdinVersion)
+			if version != tt.expected {
+				t.Errorf("getVersionInfo(%q) = %q, want %q", tt.stdinVersion, version, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAppendLedgerConcurrent(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	now := time.Date(2026, 1, 14, 15, 0, 0, 0, time.Local)
+
+	// Each worker plays one session whose cost climbs by $1 per update
+	const workers = 20
+	const updates = 25
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			sessionID := fmt.Sprintf("session-%d", w)
+			for i := 1; i <= updates; i++ {
+				appendLedger(sessionID, "/tmp/project", map[string]ledgerAmount{"Sonnet": {Cost: float64(i)}}, now)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	idx := loadLedgerIndex()
+	if cost := idx.Days["2026-01-14"].Cost; cost != workers*updates {
+		t.Errorf("day cost = %v, want %v", cost, workers*updates)
+	}
+	for w := 0; w < workers; w++ {
+		sessionID := fmt.Sprintf("session-%d", w)
+		if cost := idx.Sessions[sessionID]["Sonnet"].Cost; cost != updates {
+			t.Errorf("session %q cost = %v, want %v", sessionID, cost, updates)
+		}
+	}
+
+	// The index must match a full replay of the ledger
+	var replayed LedgerIndex
+	replayed.catchUp(ledgerPath())
+	if replayed.Days["2026-01-14"].Cost != idx.Days["2026-01-14"].Cost || replayed.Offset != idx.Offset {
+		t.Errorf("replayed index = %+v, want %+v", replayed.Days, idx.Days)
+	}
+}
+
+func TestLedgerPeriodTotals(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// Wednesday 14th, Sunday 18th, Monday 19th
+	wed := time.Date(2026, 1, 14, 10, 0, 0, 0, time.Local)
+	sun := time.Date(2026, 1, 18, 10, 0, 0, 0, time.Local)
+	mon := time.Date(2026, 1, 19, 10, 0, 0, 0, time.Local)
+
+	appendLedger("s1", "/a", map[string]ledgerAmount{"Opus": {Cost: 2, Tokens: 100}}, wed)
+	appendLedger("s1", "/a", map[string]ledgerAmount{"Opus": {Cost: 5, Tokens: 300}, "Haiku": {Cost: 1}}, sun)
+	appendLedger("s2", "/b", map[string]ledgerAmount{"Sonnet": {Cost: 4}}, mon)
+	// An unchanged total records nothing
+	appendLedger("s2", "/b", map[string]ledgerAmount{"Sonnet": {Cost: 4}}, mon)
+
+	idx := loadLedgerIndex()
+	if day := idx.Days["2026-01-18"]; day.Cost != 4 || day.Tokens != 200 || day.Models["Haiku"] != 1 {
+		t.Errorf("Sunday totals = %+v, want cost 4, tokens 200, Haiku 1", day)
+	}
+
+	week := idx.totalsBetween(weekStartKey(wed), "2026-01-19")
+	if week.Cost != 6 || week.Projects["/a"] != 6 {
+		t.Errorf("week totals = %+v, want cost 6 for /a", week)
+	}
+	if month := idx.totalsBetween("2026-01-01", "2026-02-01"); month.Cost != 10 {
+		t.Errorf("month cost = %v, want 10", month.Cost)
+	}
+}
+
+func TestAppendLedgerSessionTotal(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	now := time.Date(2026, 1, 14, 10, 0, 0, 0, time.Local)
+
+	// The official cost is a session total: switching model books only the increase
+	appendLedgerSessionTotal("s1", "/a", "Opus", ledgerAmount{Cost: 2}, now)
+	if recorded := appendLedgerSessionTotal("s1", "/a", "Sonnet", ledgerAmount{Cost: 2.1}, now.Add(time.Minute)); math.Abs(recorded-0.1) > 1e-9 {
+		t.Errorf("recorded after the model switch = %v, want 0.1", recorded)
+	}
+
+	// Costs recorded per model, e.g. by --rebuild-stats, count towards the session total
+	appendLedger("s2", "/a", map[string]ledgerAmount{"Opus": {Cost: 3}, "Haiku": {Cost: 1}}, now)
+	appendLedgerSessionTotal("s2", "/a", "Haiku", ledgerAmount{Cost: 4.5}, now.Add(time.Minute))
+
+	day := loadLedgerIndex().Days["2026-01-14"]
+	if math.Abs(day.Cost-6.6) > 1e-9 || math.Abs(day.Models["Sonnet"]-0.1) > 1e-9 || math.Abs(day.Models["Haiku"]-1.5) > 1e-9 {
+		t.Errorf("day totals = %+v, want cost 6.6 with Sonnet 0.1 and Haiku 1.5", day)
+	}
+}
+
+func TestImportLegacyStats(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	statsDir := filepath.Join(home, ".claude", "session-tracker", "stats")
+	os.MkdirAll(statsDir, 0755)
+	os.WriteFile(filepath.Join(statsDir, "daily-2026-01-10.json"), []byte(`{"total_cost":3,"session_costs":{"s1":3}}`), 0644)
+	// s1 spans midnight: only its increase counts on the second day
+	os.WriteFile(filepath.Join(statsDir, "daily-2026-01-11.json"), []byte(`{"total_cost":9,"session_costs":{"s1":5,"s2":4}}`), 0644)
+
+	// s1 continues after the upgrade; only its cost beyond the imported $5 is new
+	appendLedger("s1", "", map[string]ledgerAmount{"Opus": {Cost: 4.5}, "Haiku": {Cost: 1.5}}, time.Date(2026, 1, 12, 9, 0, 0, 0, time.Local))
+	appendLedger("s1", "", map[string]ledgerAmount{"Opus": {Cost: 6.5}, "Haiku": {Cost: 1.5}}, time.Date(2026, 1, 12, 10, 0, 0, 0, time.Local))
+
+	idx := loadLedgerIndex()
+	expected := map[string]float64{"2026-01-10": 3, "2026-01-11": 6, "2026-01-12": 3}
+	for day, want := range expected {
+		if got := idx.Days[day].Cost; math.Abs(got-want) > 1e-9 {
+			t.Errorf("Days[%q].Cost = %v, want %v", day, got, want)
+		}
+	}
+	if got := idx.Days["2026-01-12"].Models; math.Abs(got["Opus"]-2.75) > 1e-9 || math.Abs(got["Haiku"]-0.25) > 1e-9 {
+		t.Errorf("Days[2026-01-12].Models = %v, want Opus 2.75 and Haiku 0.25", got)
+	}
+}
+
+func TestRebuildStats(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	const sessionID = "c5d1e2f3-0000-4000-8000-000000000001"
+	transcript, err := os.ReadFile("testdata/transcript_streamed.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	projectDir := filepath.Join(home, ".claude", "projects", "-tmp-project")
+	os.MkdirAll(projectDir, 0755)
+	os.WriteFile(filepath.Join(projectDir, sessionID+".jsonl"), transcript, 0644)
+
+	// A wrong recorded cost for the transcript's session, and a session without a transcript
+	sessionTime := time.Date(2026, 1, 15, 9, 5, 0, 0, time.UTC)
+	day := dayKey(sessionTime)
+	appendLedger(sessionID, "", map[string]ledgerAmount{"Sonnet": {Cost: 5}}, sessionTime)
+	appendLedger("other-session", "", map[string]ledgerAmount{"Opus": {Cost: 1}}, sessionTime)
+
+	// A dry run reports the change without writing it
+	before, _ := os.ReadFile(ledgerPath())
+	result := rebuildStats(time.Time{}, true)
+	if result.Sessions != 1 || result.Transcripts != 1 {
+		t.Errorf("dry run found %d sessions in %d transcripts, want 1 in 1", result.Sessions, result.Transcripts)
+	}
+	if after, _ := os.ReadFile(ledgerPath()); !bytes.Equal(before, after) {
+		t.Error("dry run modified the ledger")
+	}
+
+	rebuildStats(time.Time{}, false)
+	first, _ := os.ReadFile(ledgerPath())
+	idx := loadLedgerIndex()
+	if cost := idx.Days[day].Cost; math.Abs(cost-1.039624) > 1e-9 {
+		t.Errorf("rebuilt day cost = %v, want 1.039624", cost)
+	}
+
+	// Rebuilding again gives the same ledger
+	rebuildStats(time.Time{}, false)
+	if second, _ := os.ReadFile(ledgerPath()); !bytes.Equal(first, second) {
+		t.Errorf("second rebuild changed the ledger:\n%s\nvs\n%s", first, second)
+	}
+
+	var session Session
+	data, _ := os.ReadFile(filepath.Join(home, ".claude", "session-tracker", "sessions", sessionID+".json"))
+	json.Unmarshal(data, &session)
+	if session.TotalSeconds != 304 || len(session.Intervals) != 1 {
+		t.Errorf("rebuilt session = %d seconds in %d intervals, want 304 in 1", session.TotalSeconds, len(session.Intervals))
+	}
+}
+
+func TestRebuildDedupMatchesCursor(t *testing.T) {
+	line := func(i, response int) []byte {
+		return []byte(fmt.Sprintf(`{"type":"assistant","sessionId":"s1","timestamp":"2026-01-15T09:%02d:%02d.000Z","requestId":"req_%d","message":{"id":"msg_%d","model":"claude-sonnet-4-5-20250929","usage":{"input_tokens":1000,"output_tokens":100}}}`,
+			i/60%60, i%60, response, response))
+	}
+	// Response 0 repeats right away, then again once it has left the window
+	var lines [][]byte
+	lines = append(lines, line(0, 0), line(1, 0))
+	for i := 1; i <= maxRecentKeys; i++ {
+		lines = append(lines, line(i+1, i))
+	}
+	lines = append(lines, line(maxRecentKeys+2, 0))
+
+	var cursor TranscriptCursor
+	sessions := make(map[string]*rebuildSession)
+	for _, l := range lines {
+		cursor.addLine(l, "s1", "")
+		addRebuildLine(sessions, l)
+	}
+
+	var rebuilt float64
+	for _, rec := range sessions["s1"].records {
+		rebuilt += rec.Cost
+	}
+	want := float64(maxRecentKeys+2) * calculateRequestCost(SessionUsageResult{InputTokens: 1000, OutputTokens: 100}, "claude-sonnet-4-5-20250929")
+	if math.Abs(cursor.Cost-want) > 1e-9 || math.Abs(rebuilt-cursor.Cost) > 1e-9 {
+		t.Errorf("cursor cost = %v, rebuilt cost = %v, want both %v", cursor.Cost, rebuilt, want)
+	}
+}
+
+func TestRebuildStatsSince(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	const sessionID = "c5d1e2f3-0000-4000-8000-000000000001"
+	transcript, _ := os.ReadFile("testdata/transcript_streamed.jsonl")
+	projectDir := filepath.Join(home, ".claude", "projects", "-tmp-project")
+	os.MkdirAll(projectDir, 0755)
+	os.WriteFile(filepath.Join(projectDir, sessionID+".jsonl"), transcript, 0644)
+
+	sessionTime := time.Date(2026, 1, 15, 9, 5, 0, 0, time.UTC)
+	appendLedger(sessionID, "", map[string]ledgerAmount{"Sonnet": {Cost: 5}}, sessionTime)
+
+	// Days before --since are left as recorded
+	rebuildStats(sessionTime.AddDate(0, 0, 1), false)
+	if cost := loadLedgerIndex().Days[dayKey(sessionTime)].Cost; cost != 5 {
+		t.Errorf("day before since cost = %v, want 5", cost)
+	}
+}
+
+func TestBuildReport(t *testing.T) {
+	at := func(day, clock string) int64 {
+		tm, _ := time.ParseInLocation("2006-01-02 15:04", day+" "+clock, time.Local)
+		return tm.Unix()
+	}
+	end := func(v int64) *int64 { return &v }
+
+	records := []LedgerRecord{
+		{Time: at("2026-01-14", "10:00"), Session: "s1", Project: "/a", Model: "Opus", Cost: 4, Tokens: 1000},
+		{Time: at("2026-01-16", "10:00"), Session: "s1", Project: "/a", Model: "Sonnet", Cost: 1, Tokens: 500},
+		{Time: at("2026-01-20", "10:00"), Session: "s2", Project: "/b", Model: "Sonnet", Cost: 2, Tokens: 200},
+	}
+	sessions := []Session{
+		{ID: "s1", Intervals: []Interval{
+			{Start: at("2026-01-14", "09:00"), End: end(at("2026-01-14", "11:00"))},
+			{Start: at("2026-01-16", "09:00"), End: end(at("2026-01-16", "09:30"))},
+		}},
+		{ID: "s2", Intervals: []Interval{
+			{Start: at("2026-01-20", "09:00"), End: end(at("2026-01-20", "10:00"))},
+		}},
+	}
+
+	summaries := []SessionSummary{sessions[0].summary(), sessions[1].summary()}
+
+	tests := []struct {
+		by, since, until string
+		keys             []string
+		costs            []float64
+		hours            []float64
+	}{
+		{"day", "", "", []string{"2026-01-14", "2026-01-16", "2026-01-20"}, []float64{4, 1, 2}, []float64{2, 0.5, 1}},
+		{"week", "", "", []string{"2026-01-12", "2026-01-19"}, []float64{5, 2}, []float64{2.5, 1}},
+		{"month", "", "", []string{"2026-01"}, []float64{7}, []float64{3.5}},
+		{"project", "", "", []string{"/a", "/b"}, []float64{5, 2}, []float64{2.5, 1}},
+		{"model", "", "", []string{"Opus", "Sonnet"}, []float64{4, 3}, []float64{0, 0}},
+		{"day", "2026-01-15", "2026-01-16", []string{"2026-01-16"}, []float64{1}, []float64{0.5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.by+tt.since, func(t *testing.T) {
+			report := buildReport(records, summaries, tt.by, tt.since, tt.until)
+			if len(report.Rows) != len(tt.keys) {
+				t.Fatalf("got %d rows, want %d: %+v", len(report.Rows), len(tt.keys), report.Rows)
+			}
+			for i, row := range report.Rows {
+				if row.Key != tt.keys[i] || row.Cost != tt.costs[i] || row.Hours != tt.hours[i] {
+					t.Errorf("row %d = %s $%v %vh, want %s $%v %vh", i, row.Key, row.Cost, row.Hours, tt.keys[i], tt.costs[i], tt.hours[i])
+				}
+			}
+		})
+	}
+
+	report := buildReport(records, summaries, "week", "", "")
+	if report.Total.Cost != 7 || report.Total.Sessions != 2 || report.Total.BurnRate != 2 {
+		t.Errorf("total = %+v, want $7 over 2 sessions at $2/h", report.Total)
+	}
+}
+
+func TestChooseSessionCost(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		official   float64
+		wantCost   float64
+		wantSource string
+	}{
+		{"default", "", 2.5, 1.25, costSourceTranscript},
+		{"transcript", costSourceTranscript, 2.5, 1.25, costSourceTranscript},
+		{"official", costSourceOfficial, 2.5, 2.5, costSourceOfficial},
+		{"official without a figure", costSourceOfficial, 0, 1.25, costSourceTranscript},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost, source := chooseSessionCost(tt.source, 1.25, tt.official)
+			if cost != tt.wantCost || source != tt.wantSource {
+				t.Errorf("chooseSessionCost() = %v, %q, want %v, %q", cost, source, tt.wantCost, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestChurnMetrics(t *testing.T) {
+	tests := []struct {
+		name           string
+		added, removed int
+		cost           float64
+		durationMS     int64
+		apiDurationMS  int64
+		linesPerDollar float64
+		apiTimePercent int
+	}{
+		{"typical", 120, 45, 0.12, 600000, 204000, 1375, 34},
+		{"no cost yet", 10, 0, 0, 1000, 500, 0, 50},
+		{"no duration yet", 10, 0, 0.5, 0, 0, 20, 0},
+		{"nothing changed", 0, 0, 1, 1000, 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			perDollar, apiPercent := churnMetrics(tt.added, tt.removed, tt.cost, tt.durationMS, tt.apiDurationMS)
+			if math.Abs(perDollar-tt.linesPerDollar) > 1e-9 || apiPercent != tt.apiTimePercent {
+				t.Errorf("churnMetrics() = %v, %d, want %v, %d", perDollar, apiPercent, tt.linesPerDollar, tt.apiTimePercent)
+			}
+		})
+	}
+}
+
+func TestProjectRoot(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	repo, _ := filepath.EvalSymlinks(t.TempDir())
+	if err := exec.Command("git", "init", "-q", repo).Run(); err != nil {
+		t.Fatal(err)
+	}
+	subdir := filepath.Join(repo, "cmd", "tool")
+	os.MkdirAll(subdir, 0755)
+	plain, _ := filepath.EvalSymlinks(t.TempDir())
+
+	tests := []struct {
+		dir      string
+		expected string
+	}{
+		{subdir, repo},
+		{repo, repo},
+		{plain, plain},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := projectRoot(tt.dir); got != tt.expected {
+			t.Errorf("projectRoot(%q) = %q, want %q", tt.dir, got, tt.expected)
+		}
+	}
+
+	t.Setenv("HOME", t.TempDir())
+	input := Input{SessionID: "project-session"}
+	input.Workspace.CurrentDir = plain
+	input.Workspace.ProjectDir = subdir
+	if got := projectDir(input); got != repo {
+		t.Errorf("projectDir with project_dir = %q, want its git toplevel %q", got, repo)
+	}
+	input.Workspace.ProjectDir = ""
+	if got := projectDir(input); got != plain {
+		t.Errorf("projectDir without project_dir = %q, want %q", got, plain)
+	}
+
+	// Once recorded, a session keeps its project without asking git again
+	updateSession(input.SessionID, repo, nil)
+	if got := projectDir(input); got != repo {
+		t.Errorf("projectDir of a recorded session = %q, want %q", got, repo)
+	}
+}
+
+func TestGetProjectStats(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	now := time.Now()
+	appendLedger("s1", "/repo/a", map[string]ledgerAmount{"Opus": {Cost: 3}}, now)
+	appendLedger("s2", "/repo/b", map[string]ledgerAmount{"Opus": {Cost: 7}}, now)
+
+	sessionsDir := filepath.Join(home, ".claude", "session-tracker", "sessions")
+	os.MkdirAll(sessionsDir, 0755)
+	end := now.Unix()
+	for _, session := range []Session{
+		{ID: "s1", Project: "/repo/a", Intervals: []Interval{{Start: end - 1200, End: &end}}},
+		{ID: "s2", Project: "/repo/b", Intervals: []Interval{{Start: end - 600, End: &end}}},
+	} {
+		data, _ := json.Marshal(session)
+		os.WriteFile(filepath.Join(sessionsDir, session.ID+".json"), data, 0644)
+		addToDayIndex(dayKey(now), session.ID)
+	}
+
+	weekStart, weekEnd := periodRange("week", now)
+	stats := getProjectStats(loadLedgerIndex(), "/repo/a", loadSessionIndex(weekStart, weekEnd))
+	if stats.DayCost != 3 || stats.WeekCost != 3 {
+		t.Errorf("project cost = day %v week %v, want 3 and 3", stats.DayCost, stats.WeekCost)
+	}
+	// Just after midnight the interval started yesterday
+	if dayKey(now.Add(-20*time.Minute)) == dayKey(now) && stats.DayTime != 20*time.Minute {
+		t.Errorf("project day time = %v, want 20m", stats.DayTime)
+	}
+}
+
+func TestBudgetUsage(t *testing.T) {
+	config := BudgetConfig{
+		Budget:   Budget{Daily: 10, Monthly: 200},
+		Projects: map[string]Budget{"/repo/a": {Weekly: 20}},
+	}
+	projectStats := ProjectStats{DayCost: 2, WeekCost: 17, MonthCost: 40}
+
+	tests := []struct {
+		name      string
+		project   string
+		dayCost   float64
+		labels    []string
+		percents  []int
+		wantLevel int
+	}{
+		{"under budget", "/repo/b", 5, []string{"day", "mon"}, []int{50, 25}, themes.BudgetOK},
+		{"project warning", "/repo/a", 5, []string{"day", "prj wk", "mon"}, []int{50, 85, 25}, themes.BudgetWarn},
+		{"over budget", "/repo/b", 12, []string{"day", "mon"}, []int{120, 25}, themes.BudgetOver},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usages, level := budgetUsage(config, tt.project, tt.dayCost, 30, 50, projectStats)
+			if len(usages) != len(tt.labels) {
+				t.Fatalf("got %d budgets, want %d: %+v", len(usages), len(tt.labels), usages)
+			}
+			for i, usage := range usages {
+				if usage.Label() != tt.labels[i] || usage.Percent != tt.percents[i] {
+					t.Errorf("budget %d = %s %d%%, want %s %d%%", i, usage.Label(), usage.Percent, tt.labels[i], tt.percents[i])
+				}
+			}
+			if level != tt.wantLevel {
+				t.Errorf("level = %d, want %d", level, tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestAddBudgetSpend(t *testing.T) {
+	config := BudgetConfig{Budget: Budget{Daily: 10}, Projects: map[string]Budget{"/repo/a": {Weekly: 20}}}
+	usages, level := budgetUsage(config, "/repo/a", 7, 15, 30, ProjectStats{WeekCost: 10})
+	if level != themes.BudgetOK {
+		t.Fatalf("level before the render's cost = %d, want ok", level)
+	}
+
+	// This render's cost counts against both the global and the project budget
+	usages, level = addBudgetSpend(config, usages, 1.5)
+	if usages[0].Percent != 85 || usages[1].Percent != 57 || level != themes.BudgetWarn {
+		t.Errorf("after adding the render's cost: day %d%%, project week %d%%, level %d; want 85%%, 57%%, warn",
+			usages[0].Percent, usages[1].Percent, level)
+	}
+}
+
+func TestFireBudgetAlerts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook uses a POSIX shell")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	out := filepath.Join(home, "alerts.log")
+	config := BudgetConfig{Hook: `echo "$STATUSLINE_BUDGET_PERIOD $STATUSLINE_BUDGET_THRESHOLD" >> "` + out + `"`}
+	now := time.Date(2026, 1, 14, 12, 0, 0, 0, time.Local)
+	day := func(percent int) []themes.BudgetUsage {
+		return []themes.BudgetUsage{{Period: "day", Spent: float64(percent), Limit: 100, Percent: percent}}
+	}
+
+	// 50%: nothing; 85%: warns once; 90%: already warned; 120% the next day: jumps past both thresholds
+	fireBudgetAlerts(config, day(50), now)
+	fireBudgetAlerts(config, day(85), now)
+	fireBudgetAlerts(config, day(90), now)
+	fireBudgetAlerts(config, day(120), now.AddDate(0, 0, 1))
+
+	// Hooks run in the background, so their output may land in either order
+	want := "day 100\nday 80"
+	var got string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		data, _ := os.ReadFile(out)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		sort.Strings(lines)
+		if got = strings.Join(lines, "\n"); got == want {
+			break
+		}
+	}
+	if got != want {
+		t.Errorf("hook output = %q, want %q", got, want)
+	}
+}
+
+func TestStatsClock(t *testing.T) {
+	t.Cleanup(func() { setClockConfig("", 0, "") })
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("timezone data not available")
+	}
+	// Sunday 2026-01-18 02:30 in Tokyo is Saturday 17:30 UTC
+	sundayNight := time.Date(2026, 1, 18, 2, 30, 0, 0, tokyo)
+	// Sunday 2026-02-01 01:00 in Tokyo
+	monthRollover := time.Date(2026, 2, 1, 1, 0, 0, 0, tokyo)
+
+	tests := []struct {
+		name      string
+		timezone  string
+		dayStart  int
+		weekStart string
+		t         time.Time
+		day       string
+		week      string
+		month     string
+	}{
+		{"tokyo midnight", "Asia/Tokyo", 0, "", sundayNight, "2026-01-18", "2026-01-12", "2026-01"},
+		{"utc", "UTC", 0, "", sundayNight, "2026-01-17", "2026-01-12", "2026-01"},
+		{"day starts at 4am", "Asia/Tokyo", 4, "", sundayNight, "2026-01-17", "2026-01-12", "2026-01"},
+		{"week starts sunday", "Asia/Tokyo", 0, "sunday", sundayNight, "2026-01-18", "2026-01-18", "2026-01"},
+		{"late night stays in previous month", "Asia/Tokyo", 4, "Sun", monthRollover, "2026-01-31", "2026-01-25", "2026-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setClockConfig(tt.timezone, tt.dayStart, tt.weekStart)
+			if got := dayKey(tt.t); got != tt.day {
+				t.Errorf("dayKey = %q, want %q", got, tt.day)
+			}
+			if got := weekStartKey(tt.t); got != tt.week {
+				t.Errorf("weekStartKey = %q, want %q", got, tt.week)
+			}
+			if got := monthKey(tt.t); got != tt.month {
+				t.Errorf("monthKey = %q, want %q", got, tt.month)
+			}
+		})
+	}
+
+	setClockConfig("UTC", 4, "")
+	if start, _ := dayKeyStart("2026-01-18"); !start.Equal(time.Date(2026, 1, 18, 4, 0, 0, 0, time.UTC)) {
+		t.Errorf("dayKeyStart = %v, want 2026-01-18 04:00 UTC", start)
+	}
+	if from, to := periodRange("month", time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)); from != "2026-02-01" || to != "2026-03-01" {
+		t.Errorf("periodRange(month) = [%s, %s), want [2026-02-01, 2026-03-01)", from, to)
+	}
+}
+
+func TestLedgerIndexFollowsClock(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(func() { setClockConfig("", 0, "") })
+
+	setClockConfig("UTC", 0, "")
+	lateNight := time.Date(2026, 1, 14, 2, 0, 0, 0, time.UTC)
+	appendLedger("s1", "", map[string]ledgerAmount{"Opus": {Cost: 3}}, lateNight)
+	if cost := loadLedgerIndex().Days["2026-01-14"].Cost; cost != 3 {
+		t.Fatalf("day cost = %v, want 3", cost)
+	}
+
+	// Moving the day start regroups existing records without touching the ledger
+	setClockConfig("UTC", 4, "")
+	idx := loadLedgerIndex()
+	if idx.Days["2026-01-13"].Cost != 3 || idx.Days["2026-01-14"].Cost != 0 {
+		t.Errorf("days after clock change = %+v, want the cost on 2026-01-13", idx.Days)
+	}
+}
+
+func TestPruneSessions(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	now := time.Date(2026, 6, 15, 12, 0, 0, 0, time.Local)
+	write := func(id string, start time.Time, seconds int64) {
+		end := start.Unix() + seconds
+		session := Session{ID: id, Date: dayKey(start), Project: "/repo", Start: start.Unix(), LastHeartbeat: end,
+			TotalSeconds: seconds, Intervals: []Interval{{Start: start.Unix(), End: &end}}}
+		data, _ := json.Marshal(session)
+		os.MkdirAll(filepath.Dir(sessionPath(id)), 0755)
+		os.WriteFile(sessionPath(id), data, 0644)
+		addToDayIndex(dayKey(start), id)
+	}
+	write("old-1", time.Date(2026, 1, 10, 9, 0, 0, 0, time.Local), 3600)
+	write("old-2", time.Date(2026, 1, 20, 9, 0, 0, 0, time.Local), 1800)
+	write("recent", time.Date(2026, 6, 10, 9, 0, 0, 0, time.Local), 600)
+	saveTranscriptCursor("old-1", TranscriptCursor{Offset: 10})
+	appendLedger("old-1", "/repo", map[string]ledgerAmount{"Sonnet": {Cost: 1}}, time.Date(2026, 1, 10, 10, 0, 0, 0, time.Local))
+	appendLedger("recent", "/repo", map[string]ledgerAmount{"Sonnet": {Cost: 2}}, time.Date(2026, 6, 10, 9, 10, 0, 0, time.Local))
+	appendLedger("no-session-file", "/repo", map[string]ledgerAmount{"Sonnet": {Cost: 3}}, time.Date(2026, 1, 5, 9, 0, 0, 0, time.Local))
+
+	if dry := pruneSessions(30, now, true); dry.Sessions != 2 || dry.Cursors != 1 || dry.DayFiles != 2 {
+		t.Errorf("dry run = %+v, want 2 sessions, 1 cursor, 2 day files", dry)
+	}
+	if _, err := os.Stat(sessionPath("old-1")); err != nil {
+		t.Fatal("dry run removed a session file")
+	}
+
+	result := pruneSessions(30, now, false)
+	if result.Sessions != 2 || len(result.Summaries) != 1 || result.Summaries[0] != "2026-01" {
+		t.Errorf("prune = %+v, want 2 sessions into 2026-01", result)
+	}
+	if _, err := os.Stat(sessionPath("old-1")); !os.IsNotExist(err) {
+		t.Error("pruned session file still exists")
+	}
+	if _, err := os.Stat(sessionPath("recent")); err != nil {
+		t.Error("recent session file was pruned")
+	}
+
+	// Pruned sessions leave the ledger index, their costs stay
+	idx := loadLedgerIndex()
+	if _, ok := idx.Sessions["old-1"]; ok || result.Ledger != 1 {
+		t.Errorf("ledger index still has old-1 (dropped %d)", result.Ledger)
+	}
+	if _, ok := idx.Sessions["recent"]; !ok {
+		t.Error("ledger index lost the recent session")
+	}
+	if _, ok := idx.Sessions["no-session-file"]; !ok {
+		t.Error("ledger index lost a session that was not pruned")
+	}
+	if cost := idx.Days["2026-01-10"].Cost; cost != 1 {
+		t.Errorf("2026-01-10 cost = %v, want 1", cost)
+	}
+
+	// A resumed pruned session only books its new spend
+	if recorded := appendLedger("old-1", "/repo", map[string]ledgerAmount{"Sonnet": {Cost: 1.2}}, now); math.Abs(recorded-0.2) > 1e-9 {
+		t.Errorf("resumed pruned session recorded %v, want 0.2", recorded)
+	}
+
+	// Pruned sessions still count in reports
+	report := buildReport(nil, loadSessionSummaries(), "month", "", "")
+	if len(report.Rows) != 2 || report.Rows[0].Hours != 1.5 || report.Rows[1].Hours != 600.0/3600 {
+		t.Errorf("report rows = %+v, want 1.5h in 2026-01 and 10m in 2026-06", report.Rows)
+	}
+
+	// Pruning again changes nothing
+	if again := pruneSessions(30, now, false); again.Sessions != 0 {
+		t.Errorf("second prune = %+v, want nothing to prune", again)
+	}
+	if summary := loadMonthlySummary("2026-01"); len(summary.Sessions) != 2 {
+		t.Errorf("summary has %d sessions, want 2", len(summary.Sessions))
+	}
+}
+
+func TestLoadSessionIndex(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	day := time.Date(2026, 1, 14, 0, 0, 0, 0, time.Local)
+	at := func(hour, minute int) int64 {
+		return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute).Unix()
+	}
+	interval := func(start, end int64) Interval { return Interval{Start: start, End: &end} }
+
+	sessions := []Session{
+		// 9:00-9:40 and 10:00-10:30 on /a
+		{ID: "s1", Project: "/a", Intervals: []Interval{interval(at(9, 0), at(9, 40)), interval(at(10, 0), at(10, 30))}},
+		// 9:30-10:10 on /b bridges s1's intervals into one 90-minute stretch
+		{ID: "s2", Project: "/b", Intervals: []Interval{interval(at(9, 30), at(10, 10))}},
+		// The previous day falls outside the index range
+		{ID: "s3", Project: "/a", Intervals: []Interval{interval(at(-5, 0), at(-4, 0))}},
+	}
+	for _, session := range sessions {
+		data, _ := json.Marshal(session)
+		os.MkdirAll(filepath.Dir(sessionPath(session.ID)), 0755)
+		os.WriteFile(sessionPath(session.ID), data, 0644)
+		addToDayIndex(dayKey(day), session.ID)
+	}
+
+	today := dayKey(day)
+	idx := loadSessionIndex(today, shiftDayKey(today, 1))
+
+	if got := idx.DaySeconds[today]; got != 110*60 {
+		t.Errorf("DaySeconds = %d, want %d", got, 110*60)
+	}
+	if got := idx.projectSeconds("/a", today, shiftDayKey(today, 1)); got != 70*60 {
+		t.Errorf("projectSeconds(/a) = %d, want %d", got, 70*60)
+	}
+	if got := idx.longestFocus(today); got != 90*time.Minute {
+		t.Errorf("longestFocus = %v, want 1h30m", got)
+	}
+	if got := calculateTotalHours(idx, today); got != "1h50m" {
+		t.Errorf("calculateTotalHours = %q, want 1h50m", got)
+	}
+	if got := calculateBurnRateValue(UsageStats{TotalCost: 11}, idx, today); math.Abs(got-6) > 1e-9 {
+		t.Errorf("calculateBurnRateValue = %v, want 6", got)
+	}
+}
+
+func TestLoadSessionIndexBackfillsDayIndex(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// A session file written before the day index existed
+	now := time.Now()
+	start, end := now.Add(-time.Hour).Unix(), now.Add(-30*time.Minute).Unix()
+	data, _ := json.Marshal(Session{ID: "old", Date: dayKey(now), Intervals: []Interval{{Start: start, End: &end}}})
+	os.MkdirAll(filepath.Dir(sessionPath("old")), 0755)
+	os.WriteFile(sessionPath("old"), data, 0644)
+
+	today := dayKey(time.Unix(start, 0))
+	idx := loadSessionIndex(today, shiftDayKey(today, 1))
+	if got := idx.DaySeconds[today]; got != 1800 {
+		t.Errorf("DaySeconds = %d, want 1800 from the existing session file", got)
+	}
+	if got := readDayIndex(today); fmt.Sprint(got) != "[old]" {
+		t.Errorf("day index = %v, want [old]", got)
+	}
+	if _, err := os.Stat(dayIndexMarker()); err != nil {
+		t.Errorf("backfill marker not written: %v", err)
+	}
+}
+
 func TestVersionVariables(t *testing.T) {
 	// Verify version variables exist and have default values
 	if Version == "" {
@@ -154,3 +990,606 @@ func TestVersionVariables(t *testing.T) {
 		t.Error("Date should not be empty")
 	}
 }
+
+func TestCalculateSessionUsageIncremental(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	transcript := filepath.Join(t.TempDir(), "session.jsonl")
+	line := func(ts string, input int) string {
+		return fmt.Sprintf(`{"sessionId":"s1","type":"assistant","timestamp":"%s","message":{"usage":{"input_tokens":%d,"output_tokens":10}}}`+"\n", ts, input)
+	}
+	appendLine := func(s string) {
+		f, err := os.OpenFile(transcript, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(s)
+		f.Close()
+	}
+
+	appendLine(line("2026-01-01T10:00:00Z", 100))
+	appendLine(`{"sessionId":"s1","type":"user","timestamp":"2026-01-01T10:01:00Z"}` + "\n")
+
+	result := calculateSessionUsage(transcript, "s1", "Sonnet")
+	if result.InputTokens != 100 || result.MessageCount != 1 {
+		t.Fatalf("first pass = %+v, want 100 input tokens and 1 message", result)
+	}
+
+	// Appended lines are picked up from the saved cursor, a partial line is not
+	appendLine(line("2026-01-01T10:05:00Z", 200))
+	appendLine(`{"sessionId":"s1","type":"assistant"`)
+
+	result = calculateSessionUsage(transcript, "s1", "Sonnet")
+	if result.InputTokens != 300 || result.OutputTokens != 20 {
+		t.Errorf("incremental pass = %+v, want 300 input and 20 output tokens", result)
+	}
+	if result.Duration != 5*time.Minute {
+		t.Errorf("incremental duration = %v, want 5m", result.Duration)
+	}
+
+	cursor := loadTranscriptCursor("s1")
+	if info, _ := os.Stat(transcript); cursor.Offset >= info.Size() {
+		t.Errorf("cursor offset %d should stop before the partial line (size %d)", cursor.Offset, info.Size())
+	}
+
+	// A truncated transcript falls back to a full rescan
+	os.WriteFile(transcript, []byte(line("2026-01-02T09:00:00Z", 50)), 0644)
+
+	result = calculateSessionUsage(transcript, "s1", "Sonnet")
+	if result.InputTokens != 50 || result.MessageCount != 0 {
+		t.Errorf("after truncation = %+v, want 50 input tokens and 0 messages", result)
+	}
+}
+
+func TestCalculateSessionUsageMixedModels(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	transcript := filepath.Join(t.TempDir(), "session.jsonl")
+	lines := `{"sessionId":"s1","type":"assistant","message":{"model":"claude-opus-4-5-20251101","usage":{"input_tokens":100000,"output_tokens":0}}}
+{"sessionId":"s1","type":"assistant","message":{"model":"claude-sonnet-4-5-20250929","usage":{"input_tokens":100000,"output_tokens":0}}}
+{"sessionId":"s1","type":"assistant","message":{"model":"claude-haiku-4-5-20251001","usage":{"input_tokens":100000,"output_tokens":0}}}
+{"sessionId":"s1","type":"assistant","message":{"usage":{"input_tokens":100000,"output_tokens":0}}}
+`
+	os.WriteFile(transcript, []byte(lines), 0644)
+
+	result := calculateSessionUsage(transcript, "s1", "Sonnet")
+
+	// Opus $0.50 + Sonnet $0.30 + Haiku $0.10, plus the unattributed entry at the session model (Sonnet)
+	if result.Cost < 1.19 || result.Cost > 1.21 {
+		t.Errorf("Cost = %v, want 1.2", result.Cost)
+	}
+
+	expected := map[string]float64{"Opus": 0.5, "Sonnet": 0.6, "Haiku": 0.1}
+	for model, want := range expected {
+		if got := result.Models[model].Cost; got < want-0.01 || got > want+0.01 {
+			t.Errorf("Models[%q].Cost = %v, want %v", model, got, want)
+		}
+	}
+
+	breakdown := modelCostBreakdown(result.Models)
+	if len(breakdown) != 3 || breakdown[0].Model != "Sonnet" || breakdown[2].Model != "Haiku" {
+		t.Errorf("modelCostBreakdown() = %+v, want Sonnet, Opus, Haiku", breakdown)
+	}
+}
+
+func TestCalculateSessionUsageDeduplicatesStreamedEntries(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// Four API responses written as eight assistant lines (one per content block)
+	result := calculateSessionUsage("testdata/transcript_streamed.jsonl", "c5d1e2f3-0000-4000-8000-000000000001", "Sonnet")
+
+	if result.InputTokens != 28 {
+		t.Errorf("InputTokens = %d, want 28", result.InputTokens)
+	}
+	if result.OutputTokens != 590 {
+		t.Errorf("OutputTokens = %d, want 590", result.OutputTokens)
+	}
+	if result.CacheReadTokens != 67300 {
+		t.Errorf("CacheReadTokens = %d, want 67300", result.CacheReadTokens)
+	}
+	if result.CacheWriteTokens != 2800 {
+		t.Errorf("CacheWriteTokens = %d, want 2800", result.CacheWriteTokens)
+	}
+	if result.MessageCount != 4 {
+		t.Errorf("MessageCount = %d, want 4", result.MessageCount)
+	}
+
+	// Sonnet: 28*$3 + 590*$15 + 67300*$0.30 + 2800*$3.75 per 1M tokens
+	if result.Cost < 0.039623 || result.Cost > 0.039625 {
+		t.Errorf("Cost = %v, want 0.039624", result.Cost)
+	}
+}
+
+func TestCalculateSessionUsageSidechains(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	transcript := filepath.Join(t.TempDir(), "session.jsonl")
+	lines := `{"sessionId":"s1","type":"user","parentUuid":null,"uuid":"u1","message":{"role":"user","content":"hi"}}
+{"sessionId":"s1","type":"assistant","parentUuid":"u1","uuid":"a1","message":{"id":"m1","model":"claude-sonnet-4-5","usage":{"input_tokens":100000,"output_tokens":0}}}
+{"sessionId":"s1","type":"user","isSidechain":true,"parentUuid":null,"uuid":"t1","message":{"role":"user","content":"task one"}}
+{"sessionId":"s1","type":"assistant","isSidechain":true,"parentUuid":"t1","uuid":"t2","message":{"id":"m2","model":"claude-haiku-4-5","usage":{"input_tokens":100000,"output_tokens":0}}}
+{"sessionId":"s1","type":"user","isSidechain":true,"parentUuid":"t2","uuid":"t3","message":{"role":"user","content":[{"type":"tool_result"}]}}
+{"sessionId":"s1","type":"user","isSidechain":true,"parentUuid":null,"uuid":"t4","message":{"role":"user","content":"task two"}}
+{"sessionId":"s1","type":"assistant","isSidechain":true,"parentUuid":"t4","uuid":"t5","message":{"id":"m3","model":"claude-haiku-4-5","usage":{"input_tokens":0,"output_tokens":200000}}}
+`
+	os.WriteFile(transcript, []byte(lines), 0644)
+
+	result := calculateSessionUsage(transcript, "s1", "Sonnet")
+
+	if result.InputTokens != 100000 || result.MessageCount != 1 {
+		t.Errorf("main thread = %+v, want only the non-sidechain usage and message", result)
+	}
+	if result.Cost < 0.29 || result.Cost > 0.31 {
+		t.Errorf("Cost = %v, want 0.3", result.Cost)
+	}
+	if result.SubagentCount != 2 {
+		t.Errorf("SubagentCount = %d, want 2", result.SubagentCount)
+	}
+	if result.Subagents.Tokens() != 300000 {
+		t.Errorf("Subagents.Tokens() = %d, want 300000", result.Subagents.Tokens())
+	}
+	// Haiku: 100K input at $1 + 200K output at $5 per 1M
+	if result.Subagents.Cost < 1.09 || result.Subagents.Cost > 1.11 {
+		t.Errorf("Subagents.Cost = %v, want 1.1", result.Subagents.Cost)
+	}
+}
+
+func TestCalculateSessionUsageActivity(t *testing.T) {
+	t.Cleanup(func() { applyConfig(Config{}) })
+
+	tests := []struct {
+		name    string
+		idleGap int
+		want    []int64 // Interval lengths in seconds
+	}{
+		{"default gap", 0, []int64{304}},
+		{"short gap", 120, []int64{20, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			applyConfig(Config{IdleGap: tt.idleGap})
+
+			result := calculateSessionUsage("testdata/transcript_streamed.jsonl", "c5d1e2f3-0000-4000-8000-000000000001", "Sonnet")
+
+			var got []int64
+			for _, interval := range result.Activity {
+				got = append(got, *interval.End-interval.Start)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Activity lengths = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateSessionActivity(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	now := time.Now().Unix()
+	start, end := now-3600, now-3000
+	updateSession("s1", "/work/app", []Interval{{Start: start, End: &end}})
+
+	session, ok := loadSession("s1")
+	if !ok {
+		t.Fatal("session file was not written")
+	}
+	if len(session.Intervals) != 1 || session.Start != start || session.TotalSeconds != 600 {
+		t.Errorf("session = %+v, want the transcript interval of 600s", session)
+	}
+}
+
+func TestBuildTimesheet(t *testing.T) {
+	t.Cleanup(func() { setClockConfig("", 0, "") })
+	setClockConfig("UTC", 0, "")
+
+	at := func(clock string) int64 {
+		ts, _ := time.Parse(time.RFC3339, "2026-03-02T"+clock+"Z")
+		return ts.Unix()
+	}
+	interval := func(from, to string) Interval {
+		end := at(to)
+		return Interval{Start: at(from), End: &end}
+	}
+	sessions := []Session{
+		{ID: "s1", Project: "/work/app", Intervals: []Interval{
+			interval("09:00:00", "10:00:00"),
+			interval("10:05:00", "10:30:00"),
+			{Start: at("11:00:00")}, // Still open
+		}},
+		{ID: "s2", Project: "/work/app", Intervals: []Interval{interval("09:30:00", "10:15:00")}},
+		{ID: "s3", Project: "/work/lib", Intervals: []Interval{interval("09:10:00", "09:40:00")}},
+		{ID: "s4", Project: "/work/app", Intervals: []Interval{interval("10:50:00", "11:00:00")}},
+	}
+
+	tests := []struct {
+		name     string
+		project  string
+		since    string
+		mergeGap int64
+		want     []string
+	}{
+		{"overlaps merged", "", "", 0, []string{
+			"/work/app 09:00-10:30 [s1 s2]",
+			"/work/lib 09:10-09:40 [s3]",
+			"/work/app 10:50-11:00 [s4]",
+		}},
+		{"nearby intervals merged", "/work/app", "", 1200, []string{"/work/app 09:00-11:00 [s1 s2 s4]"}},
+		{"project filter by name", "lib", "", 0, []string{"/work/lib 09:10-09:40 [s3]"}},
+		{"since excludes earlier days", "", "2026-03-03", 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, entry := range buildTimesheet(sessions, tt.project, tt.since, "", tt.mergeGap) {
+				got = append(got, fmt.Sprintf("%s %s-%s %v", entry.Project,
+					time.Unix(entry.Start, 0).UTC().Format("15:04"),
+					time.Unix(entry.End, 0).UTC().Format("15:04"), entry.Sessions))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("entries = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimesheetRangeWarning(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.Local)
+
+	if got := timesheetRangeWarning("2026-05-01", 90, now); got != "" {
+		t.Errorf("range within retention warned: %q", got)
+	}
+	if got := timesheetRangeWarning("2026-01-01", 90, now); !strings.Contains(got, "before 2026-03-03") {
+		t.Errorf("range before the cutoff = %q, want a warning naming 2026-03-03", got)
+	}
+	if got := timesheetRangeWarning("", 90, now); got != "" {
+		t.Errorf("no --since and nothing pruned warned: %q", got)
+	}
+	writeFileAtomic(summaryPath("2026-01"), []byte(`{"month":"2026-01"}`), 0644)
+	if got := timesheetRangeWarning("", 90, now); got == "" {
+		t.Error("no --since after a prune did not warn")
+	}
+}
+
+func TestWriteTimesheetICS(t *testing.T) {
+	entries := []TimesheetEntry{{
+		Project:  "/work/app, the " + strings.Repeat("long ", 20) + "one",
+		Start:    1772442000,
+		End:      1772445600,
+		Sessions: []string{"s1", "s2"},
+	}}
+
+	var buf bytes.Buffer
+	writeTimesheetICS(&buf, entries, time.Unix(1772449200, 0))
+	out := buf.String()
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"DTSTART:20260302T090000Z\r\n",
+		"DTEND:20260302T100000Z\r\n",
+		`DESCRIPTION:Project: /work/app\, the long`,
+		"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("ICS output missing %q:\n%s", want, out)
+		}
+	}
+	for _, line := range strings.Split(out, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+	}
+}
+
+func TestFetchAPIUsageStaleWhileRevalidate(t *testing.T) {
+	original := startAPIUsageRefresh
+	t.Cleanup(func() { startAPIUsageRefresh = original })
+
+	now := time.Now()
+	tests := []struct {
+		name        string
+		cache       *APIUsageCache
+		wantUsage   bool
+		wantRefresh bool
+		wantStatus  string
+	}{
+		{"no cache", nil, false, true, ""},
+		{"fresh", &APIUsageCache{CachedAt: now.Add(-time.Minute), CheckedAt: now.Add(-time.Minute), Status: "ok"}, true, false, "ok"},
+		{"expired", &APIUsageCache{CachedAt: now.Add(-8 * time.Minute), CheckedAt: now.Add(-8 * time.Minute), Status: "ok"}, true, true, "ok"},
+		{"stale", &APIUsageCache{CachedAt: now.Add(-time.Hour), CheckedAt: now.Add(-time.Hour), Status: "ok"}, true, true, "stale"},
+		{"stale, failed refresh just now", &APIUsageCache{CachedAt: now.Add(-time.Hour), CheckedAt: now.Add(-time.Minute), Status: "offline"}, true, false, "offline"},
+		{"never fetched", &APIUsageCache{CheckedAt: now.Add(-time.Minute), Status: "unauthenticated"}, false, false, "unauthenticated"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			refreshed := 0
+			startAPIUsageRefresh = func() { refreshed++ }
+
+			if tt.cache != nil {
+				tt.cache.Usage.Limits = map[string]APILimit{"five_hour": {Utilization: 42}}
+				data, _ := json.Marshal(tt.cache)
+				writeFileAtomic(apiUsageCachePath(), data, 0644)
+			}
+
+			state := fetchAPIUsage(Config{})
+			usage := state.Usage
+			if state.Status != tt.wantStatus {
+				t.Errorf("Status = %q, want %q", state.Status, tt.wantStatus)
+			}
+			if (usage != nil) != tt.wantUsage {
+				t.Errorf("fetchAPIUsage() = %v, want usage %v", usage, tt.wantUsage)
+			}
+			if usage != nil && usage.Limits["five_hour"].Utilization != 42 {
+				t.Errorf("five_hour utilization = %v, want the cached 42", usage.Limits["five_hour"].Utilization)
+			}
+			if (refreshed > 0) != tt.wantRefresh {
+				t.Errorf("refresh started %d times, want refresh %v", refreshed, tt.wantRefresh)
+			}
+		})
+	}
+}
+
+func TestRefreshAPIUsage(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	stale := time.Now().Add(-time.Hour).Truncate(time.Second)
+	cache := APIUsageCache{CachedAt: stale, CheckedAt: stale}
+	cache.Usage.Limits = map[string]APILimit{"five_hour": {Utilization: 42}}
+	data, _ := json.Marshal(cache)
+	writeFileAtomic(apiUsageCachePath(), data, 0644)
+
+	// Another refresher holds the lock: nothing happens
+	withFileLock(apiUsageCachePath()+".refresh", func() {
+		refreshAPIUsage(Config{})
+	})
+	if cached, _ := readAPIUsageCache(); !cached.CheckedAt.Equal(stale) {
+		t.Errorf("CheckedAt = %v while locked, want unchanged", cached.CheckedAt)
+	}
+
+	// No OAuth token (an empty credentials file also skips the macOS keychain):
+	// the attempt and its error are recorded and the old usage kept
+	os.WriteFile(filepath.Join(os.Getenv("HOME"), ".claude", ".credentials.json"), []byte(`{}`), 0600)
+	refreshAPIUsage(Config{})
+	cached, _ := readAPIUsageCache()
+	if time.Since(cached.CheckedAt) > time.Minute {
+		t.Errorf("CheckedAt = %v, want the failed attempt recorded", cached.CheckedAt)
+	}
+	if cached.Status != "unauthenticated" || cached.LastError == "" || !cached.LastErrorAt.Equal(cached.CheckedAt) {
+		t.Errorf("Status = %q, LastError = %q, want the missing token recorded", cached.Status, cached.LastError)
+	}
+	if !cached.CachedAt.Equal(stale) || cached.Usage.Limits["five_hour"].Utilization != 42 {
+		t.Errorf("cache = %+v, want the previous usage kept", cached)
+	}
+
+	// Without any usage ever fetched (API key users) a missing token is no problem to show
+	os.Remove(apiUsageCachePath())
+	refreshAPIUsage(Config{})
+	cached, _ = readAPIUsageCache()
+	if cached.Status != "" || cached.LastError == "" {
+		t.Errorf("Status = %q, LastError = %q, want no status but the error recorded", cached.Status, cached.LastError)
+	}
+}
+
+func TestParseAPIUsage(t *testing.T) {
+	body := `{
+		"five_hour": {"utilization": 23.0, "resets_at": "2026-03-02T14:00:00Z"},
+		"seven_day": {"utilization": 67.5, "resets_at": "2026-03-05T09:00:00Z"},
+		"seven_day_opus": {"utilization": 41.0, "resets_at": null},
+		"seven_day_oauth_apps": null,
+		"extra_usage": {"is_enabled": false}
+	}`
+
+	usage, ok := parseAPIUsage([]byte(body))
+	if !ok {
+		t.Fatal("parseAPIUsage() = false, want true")
+	}
+	want := map[string]APILimit{
+		"five_hour":      {Utilization: 23, ResetsAt: "2026-03-02T14:00:00Z"},
+		"seven_day":      {Utilization: 67.5, ResetsAt: "2026-03-05T09:00:00Z"},
+		"seven_day_opus": {Utilization: 41},
+	}
+	if fmt.Sprint(usage.Limits) != fmt.Sprint(want) {
+		t.Errorf("Limits = %v, want %v", usage.Limits, want)
+	}
+
+	if _, ok := parseAPIUsage([]byte(`{"error": {"type": "rate_limit_error"}}`)); ok {
+		t.Error("parseAPIUsage() of an error body = true, want false")
+	}
+}
+
+func TestProjectExhaustion(t *testing.T) {
+	base := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC).Unix()
+	samples := func(name string, minutes []int, values []float64) []APIUsageSample {
+		var out []APIUsageSample
+		for i := range minutes {
+			out = append(out, APIUsageSample{Time: base + int64(minutes[i])*60, Limits: map[string]float64{name: values[i]}})
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		samples []APIUsageSample
+		bucket  string
+		limit   APILimit
+		want    string // Projected time as 15:04, or empty
+	}{
+		{"rising", samples("five_hour", []int{0, 30, 60}, []float64{40, 50, 60}), "five_hour", APILimit{}, "12:00"},
+		{"only the last hour counts", samples("five_hour", []int{0, 60, 90, 120}, []float64{0, 50, 55, 60}), "five_hour", APILimit{}, "15:00"},
+		{"flat", samples("five_hour", []int{0, 30, 60}, []float64{40, 40, 40}), "five_hour", APILimit{}, ""},
+		{"span too short", samples("five_hour", []int{0, 5}, []float64{40, 50}), "five_hour", APILimit{}, ""},
+		{"window reset", samples("five_hour", []int{0, 30, 60}, []float64{80, 90, 5}), "five_hour", APILimit{}, ""},
+		{"resets first", samples("five_hour", []int{0, 30, 60}, []float64{40, 50, 60}), "five_hour", APILimit{ResetsAt: "2026-03-02T11:30:00Z"}, ""},
+		{"weekly", samples("seven_day_opus", []int{0, 720, 1440}, []float64{20, 30, 40}), "seven_day_opus", APILimit{ResetsAt: "2026-03-08T00:00:00Z"}, "2026-03-06 09:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if exhaust := projectExhaustion(tt.samples, tt.bucket, tt.limit); !exhaust.IsZero() {
+				got = exhaust.UTC().Format("15:04")
+				if len(tt.want) > 5 {
+					got = exhaust.UTC().Format("2006-01-02 15:04")
+				}
+			}
+			if got != tt.want {
+				t.Errorf("projectExhaustion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordAPIUsage(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	now := time.Now()
+
+	old := APIUsage{Limits: map[string]APILimit{"five_hour": {Utilization: 10}}}
+	recordAPIUsage(old, now.Add(-9*24*time.Hour))
+	recordAPIUsage(old, now.Add(-time.Hour))
+	history := recordAPIUsage(APIUsage{Limits: map[string]APILimit{"five_hour": {Utilization: 20}, "seven_day": {Utilization: 5}}}, now)
+
+	if len(history) != 2 {
+		t.Fatalf("history has %d samples, want 2 (the 9-day-old one dropped)", len(history))
+	}
+	if got := readAPIHistory(); fmt.Sprint(got) != fmt.Sprint(history) {
+		t.Errorf("history file = %v, want %v", got, history)
+	}
+	if history[1].Limits["seven_day"] != 5 {
+		t.Errorf("latest sample = %v, want every bucket recorded", history[1])
+	}
+}
+
+func TestAPIBaseURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		env     string
+		want    string
+		wantErr bool
+	}{
+		{"default", "", "", "https://api.anthropic.com", false},
+		{"config", "https://gateway.example.com/anthropic/", "", "https://gateway.example.com/anthropic", false},
+		{"environment overrides config", "https://gateway.example.com", "http://localhost:8080", "http://localhost:8080", false},
+		{"http to loopback IP", "http://127.0.0.1:9000", "", "http://127.0.0.1:9000", false},
+		{"http to IPv6 loopback", "http://[::1]:9000", "", "http://[::1]:9000", false},
+		{"http to remote host", "http://gateway.example.com", "", "", true},
+		{"other scheme", "ftp://gateway.example.com", "", "", true},
+		{"no host", "gateway.example.com", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CLAUDE_STATUSLINE_API_BASE_URL", tt.env)
+			got, err := (Config{APIBaseURL: tt.config}).apiBaseURL()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("apiBaseURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("apiBaseURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// usageServer serves one canned response and checks the request reached the expected path
+func usageServer(t *testing.T, path string, status int, headers map[string]string, body string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			t.Errorf("request path = %q, want %q", r.URL.Path, path)
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("Authorization = %q, want the bearer token", r.Header.Get("Authorization"))
+		}
+		for k, v := range headers {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+var rateLimitHeaders = map[string]string{
+	"anthropic-ratelimit-unified-5h-utilization": "0.25",
+	"anthropic-ratelimit-unified-5h-reset":       "1772456400",
+	"anthropic-ratelimit-unified-7d-utilization": "0.6",
+	"anthropic-ratelimit-unified-7d-reset":       "1772701200",
+}
+
+func TestFetchViaOAuthUsage(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		headers map[string]string
+		body    string
+		want    string // five_hour and seven_day utilization, or the error status
+	}{
+		{"success", 200, nil, `{"five_hour":{"utilization":23,"resets_at":"2026-03-02T14:00:00Z"},"seven_day":{"utilization":67,"resets_at":"2026-03-05T09:00:00Z"},"seven_day_opus":null}`, "23 67"},
+		{"unauthorized", 401, nil, `{"error":{"type":"authentication_error"}}`, "unauthenticated"},
+		{"rate limited", 429, rateLimitHeaders, `{"error":{"type":"rate_limit_error"}}`, "rate_limited"},
+		{"server error", 503, nil, "", "offline"},
+		{"malformed JSON", 200, nil, `{"five_hour":`, "error"},
+		{"header-only", 200, rateLimitHeaders, "", "25 60"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := usageServer(t, "/api/oauth/usage", tt.status, tt.headers, tt.body)
+			usage, err := fetchViaOAuthUsage(server.URL, "token")
+			got := apiErrorStatus(err)
+			if err == nil {
+				got = fmt.Sprint(usage.Limits["five_hour"].Utilization, usage.Limits["seven_day"].Utilization)
+			}
+			if got != tt.want {
+				t.Errorf("fetchViaOAuthUsage() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchViaHaikuProbe(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		headers map[string]string
+		body    string
+		want    string
+	}{
+		{"success", 200, rateLimitHeaders, `{"type":"message","content":[{"type":"text","text":"Hi"}]}`, "25 60"},
+		{"unauthorized", 401, nil, `{"error":{"type":"authentication_error"}}`, "unauthenticated"},
+		{"rate limited", 429, rateLimitHeaders, `{"error":{"type":"rate_limit_error"}}`, "25 60"},
+		{"rate limited without headers", 429, nil, `{"error":{"type":"rate_limit_error"}}`, "rate_limited"},
+		{"malformed JSON", 200, rateLimitHeaders, `{"type":`, "25 60"},
+		{"header-only", 200, rateLimitHeaders, "", "25 60"},
+		{"no rate limit headers", 200, nil, `{"type":"message"}`, "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := usageServer(t, "/v1/messages", tt.status, tt.headers, tt.body)
+			usage, err := fetchViaHaikuProbe(server.URL, "token")
+			got := apiErrorStatus(err)
+			if err == nil {
+				got = fmt.Sprint(usage.Limits["five_hour"].Utilization, usage.Limits["seven_day"].Utilization)
+			}
+			if got != tt.want {
+				t.Errorf("fetchViaHaikuProbe() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchUnreachableAPI(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	_, err := fetchViaOAuthUsage(server.URL, "token")
+	if got := apiErrorStatus(err); got != "offline" {
+		t.Errorf("status = %q (%v), want offline", got, err)
+	}
+}
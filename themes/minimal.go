@@ -3,6 +3,7 @@ package themes
 import (
 	"fmt"
 	"strings"
+	"time"
 	"unicode"
 )
 
@@ -17,6 +18,9 @@ func (t *MinimalTheme) Name() string {
 	return "minimal"
 }
 
+// RendersAPIExtras marks that the theme shows the API status, Opus limit and forecasts itself
+func (t *MinimalTheme) RendersAPIExtras() {}
+
 func (t *MinimalTheme) Description() string {
 	return "Minimal tree-style: no border frame, tree structure display"
 }
@@ -44,12 +48,24 @@ func (t *MinimalTheme) Render(data StatusData) string {
 	sb.WriteString(minimalTwoColumn(leftSide3, rightSide3, width))
 
 	// Line 4: | 7day bar
-	leftSide4 := fmt.Sprintf(" %s└─%s %s",
-		ColorTreeDim, Reset,
+	branch4 := "└─"
+	if len(data.Budgets) > 0 {
+		branch4 = "├─"
+	}
+	leftSide4 := fmt.Sprintf(" %s%s%s %s",
+		ColorTreeDim, branch4, Reset,
 		t.formatCostLine2(data))
 	rightSide4 := t.format7dayBar(data)
 	sb.WriteString(minimalTwoColumn(leftSide4, rightSide4, width))
 
+	// Line 5: Budget bars (only when budgets are configured)
+	if len(data.Budgets) > 0 {
+		line5 := fmt.Sprintf(" %s└─%s %s",
+			ColorTreeDim, Reset,
+			t.formatBudgetLine(data))
+		sb.WriteString(minimalPadLine(line5, width, ""))
+	}
+
 	return sb.String()
 }
 
@@ -170,26 +186,75 @@ func (t *MinimalTheme) formatHeader(data StatusData) string {
 }
 
 func (t *MinimalTheme) formatSessionLine(data StatusData) string {
-	return fmt.Sprintf("%sSession%s  %s%s%s tok  %s%d%s msg  %s%s%s  %s%d%%%s hit",
+	line := fmt.Sprintf("%sSession%s  %s%s%s tok  %s%d%s msg  %s%s%s  %s%d%%%s hit",
 		ColorLabel, Reset,
 		ColorPurple, FormatTokens(data.TokenCount), Reset,
 		ColorCyan, data.MessageCount, Reset,
 		ColorSilver, data.SessionTime, Reset,
 		ColorGreen, data.CacheHitRate, Reset)
+
+	if data.LongestFocus >= time.Minute {
+		line += fmt.Sprintf("  %sfocus%s %s%s%s",
+			ColorDim, Reset, ColorSilver, FormatDuration(data.LongestFocus), Reset)
+	}
+	return line
 }
 
 func (t *MinimalTheme) formatCostLine(data StatusData) string {
-	return fmt.Sprintf("%sCost%s     ses %s%s%s  day %s%s%s  %s%s/h%s",
+	line := fmt.Sprintf("%sCost%s     ses %s%s%s  day %s%s%s  %s%s/h%s",
 		ColorLabel, Reset,
 		ColorGreen, FormatCostShort(data.SessionCost), Reset,
 		ColorYellow, FormatCostShort(data.DayCost), Reset,
 		ColorRed, FormatCostShort(data.BurnRate), Reset)
+
+	if data.SubagentCount > 0 {
+		line += fmt.Sprintf("  %ssub %s%s%s",
+			ColorDim, ColorPurple, FormatCostShort(data.SubagentCost), Reset)
+	}
+	return line
 }
 
 func (t *MinimalTheme) formatCostLine2(data StatusData) string {
-	return fmt.Sprintf("         mon %s%s%s  wk %s%s%s",
+	line := fmt.Sprintf("         mon %s%s%s  wk %s%s%s",
 		ColorPurple, FormatCostShort(data.MonthCost), Reset,
 		ColorBlue, FormatCostShort(data.WeekCost), Reset)
+
+	// Spend and time on the current project across its sessions
+	if data.ProjectWeekCost > 0 {
+		line += fmt.Sprintf("  %sprj%s %s%s%s%s/%s%s%s",
+			ColorDim, Reset,
+			ColorYellow, FormatCostShort(data.ProjectDayCost), Reset,
+			ColorDim, ColorBlue, FormatCostShort(data.ProjectWeekCost), Reset)
+		if data.ProjectDayTime > 0 {
+			line += fmt.Sprintf(" %s%s%s", ColorSilver, FormatDuration(data.ProjectDayTime), Reset)
+		}
+	}
+
+	// Mixed-model sessions show where the session cost went
+	if len(data.ModelCosts) > 1 {
+		line += fmt.Sprintf("  %s%s%s", ColorDim, FormatModelCosts(data.ModelCosts), Reset)
+	}
+	return line
+}
+
+func (t *MinimalTheme) formatBudgetLine(data StatusData) string {
+	labelColor := ColorLabel
+	switch data.BudgetLevel {
+	case BudgetWarn:
+		labelColor = ColorOrange
+	case BudgetOver:
+		labelColor = ColorRed
+	}
+
+	line := fmt.Sprintf("%sBudget%s", labelColor, Reset)
+	for _, budget := range data.Budgets {
+		color, bgColor := GetBarColor(budget.Percent)
+		line += fmt.Sprintf("  %s%s%s %s %s%d%%%s",
+			ColorLabelDim, budget.Label(), Reset,
+			GenerateGlowBar(min(budget.Percent, 100), 6, color, bgColor),
+			color, budget.Percent, Reset)
+	}
+	return line
 }
 
 func (t *MinimalTheme) formatContextBar(data StatusData) string {
@@ -197,31 +262,55 @@ func (t *MinimalTheme) formatContextBar(data StatusData) string {
 	bar := GenerateGlowBar(data.ContextPercent, 18, color, bgColor)
 	pctColor := GetContextColor(data.ContextPercent)
 
-	return fmt.Sprintf("%sCtx%s %s %s%d%%%s %s%s%s",
+	ctx := fmt.Sprintf("%sCtx%s %s %s%d%%%s %s%s%s",
 		ColorLabelDim, Reset,
 		bar,
 		pctColor, data.ContextPercent, Reset,
 		ColorDim, FormatNumber(data.ContextUsed), Reset)
+
+	// Warn when requests are billed at the long-context premium
+	if data.LongContext {
+		ctx += fmt.Sprintf(" %s$$%s", ColorNeonOrange, Reset)
+	}
+	return ctx
 }
 
 func (t *MinimalTheme) format5hrBar(data StatusData) string {
 	color, bgColor := GetBarColor(data.API5hrPercent)
 	bar := GenerateGlowBar(data.API5hrPercent, 18, color, bgColor)
 
-	return fmt.Sprintf("%s5hr%s %s %s%d%%%s %s%s%s",
+	line := fmt.Sprintf("%s5hr%s %s %s%d%%%s %s%s%s",
 		ColorLabelDim, Reset,
 		bar,
 		color, data.API5hrPercent, Reset,
 		ColorDim, data.API5hrTimeLeft, Reset)
+	if data.API5hrProjectedExhaust != "" {
+		line += fmt.Sprintf(" %s→100%% %s%s", ColorNeonOrange, data.API5hrProjectedExhaust, Reset)
+	}
+	if status := APIStatusLabel(data.APIStatus, data.APICacheAge); status != "" {
+		line += fmt.Sprintf(" %s⚠ %s%s", ColorNeonOrange, status, Reset)
+	}
+	return line
 }
 
 func (t *MinimalTheme) format7dayBar(data StatusData) string {
 	color, bgColor := GetBarColor(data.API7dayPercent)
 	bar := GenerateGlowBar(data.API7dayPercent, 18, color, bgColor)
 
-	return fmt.Sprintf("%s7dy%s %s %s%d%%%s %s%s%s",
+	line := fmt.Sprintf("%s7dy%s %s %s%d%%%s %s%s%s",
 		ColorLabelDim, Reset,
 		bar,
 		color, data.API7dayPercent, Reset,
 		ColorDim, data.API7dayTimeLeft, Reset)
+	if data.API7dayProjectedExhaust != "" {
+		line += fmt.Sprintf(" %s→100%% %s%s", ColorNeonOrange, data.API7dayProjectedExhaust, Reset)
+	}
+	if opus, ok := data.APILimits[LimitSevenDayOpus]; ok {
+		opusColor, _ := GetBarColor(opus.Percent)
+		line += fmt.Sprintf(" %sopus%s %s%d%%%s", ColorLabelDim, Reset, opusColor, opus.Percent, Reset)
+		if opus.Exhaust != "" {
+			line += fmt.Sprintf(" %s→100%% %s%s", ColorNeonOrange, opus.Exhaust, Reset)
+		}
+	}
+	return line
 }
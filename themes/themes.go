@@ -3,6 +3,7 @@ package themes
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 // ANSI color definitions
@@ -63,9 +64,11 @@ type StatusData struct {
 	// Version info
 	Version         string
 	UpdateAvailable bool
+	OutputStyle     string
 
 	// Workspace info
 	ProjectPath string
+	ProjectDir  string // Project the session's stats are attributed to: its git toplevel, not necessarily the launch directory
 	GitBranch   string
 	GitStaged   int
 	GitDirty    int
@@ -74,26 +77,146 @@ type StatusData struct {
 	TokenCount   int64
 	MessageCount int
 	SessionTime  string
+	LongestFocus time.Duration // Longest continuous activity today
 	CacheHitRate int
 
 	// Cost
-	SessionCost float64
-	DayCost     float64
-	MonthCost   float64
-	WeekCost    float64
-	BurnRate    float64
+	SessionCost  float64
+	CostSource   string      // "transcript" or "official"
+	OfficialCost float64     // Claude Code's own session cost estimate
+	ModelCosts   []ModelCost // Per-model session cost, highest first
+	DayCost      float64
+	MonthCost    float64
+	WeekCost     float64
+	BurnRate     float64
+
+	// Current project (git toplevel or Claude Code's project dir) across all its sessions
+	ProjectDayCost  float64
+	ProjectWeekCost float64
+	ProjectDayTime  time.Duration
+	ProjectWeekTime time.Duration
+
+	// Task subagents (sidechains); only the official SessionCost includes them
+	SubagentCost   float64
+	SubagentTokens int64
+	SubagentCount  int
+
+	// Session activity reported by Claude Code
+	LinesAdded     int
+	LinesRemoved   int
+	LinesPerDollar float64 // (added + removed) / SessionCost
+	WallTime       time.Duration
+	APITime        time.Duration
+	APITimePercent int // Share of wall time spent waiting on the model
 
 	// Context
 	ContextUsed    int
 	ContextPercent int
+	LongContext    bool // Latest request was billed at long-context (>200K) rates
 
 	// API limits
 	API5hrPercent   int
 	API5hrTimeLeft  string
 	API7dayPercent  int
 	API7dayTimeLeft string
+	APILimits       map[string]APILimit // Every bucket reported by the usage API, by name
+
+	// Time left until the 5-hour/7-day limit is projected to reach 100% at the
+	// recent rate of use; empty when it is not on track to before resetting
+	API5hrProjectedExhaust  string
+	API7dayProjectedExhaust string
+
+	// Outcome of the last usage API refresh (APIStatusOK, ...; empty before the
+	// first one) and the age of the API figures shown
+	APIStatus   string
+	APICacheAge time.Duration
+
+	// ShowAPIExtras adds the API status, Opus limit and forecasts on an extra
+	// line for themes that don't show them (api_extras_line in the config)
+	ShowAPIExtras bool
+
+	// Budgets: configured spend limits, day before week before month, global before project
+	Budgets     []BudgetUsage
+	BudgetLevel int // BudgetOK, BudgetWarn or BudgetOver
+}
+
+// ModelCost is the session cost attributed to a single model
+type ModelCost struct {
+	Model string // Opus, Sonnet, Haiku
+	Cost  float64
+}
+
+// BudgetUsage is the spend against one configured budget
+type BudgetUsage struct {
+	Period  string // "day", "week" or "month"
+	Project string // Project path for per-project budgets, empty for global ones
+	Spent   float64
+	Limit   float64
+	Percent int
+}
+
+// Label returns a short budget label such as "day" or "prj wk"
+func (b BudgetUsage) Label() string {
+	label := map[string]string{"day": "day", "week": "wk", "month": "mon"}[b.Period]
+	if b.Project != "" {
+		return "prj " + label
+	}
+	return label
 }
 
+// APILimit is the usage of one API rate limit bucket
+type APILimit struct {
+	Percent  int
+	TimeLeft string
+	Exhaust  string // Time left until projected to reach 100%, empty if not before the reset
+}
+
+// Usage API rate limit buckets
+const (
+	LimitFiveHour     = "five_hour"
+	LimitSevenDay     = "seven_day"
+	LimitSevenDayOpus = "seven_day_opus"
+)
+
+// Usage API statuses
+const (
+	APIStatusOK              = "ok"
+	APIStatusStale           = "stale"           // Refreshes are not happening; the figures are old
+	APIStatusUnauthenticated = "unauthenticated" // No OAuth token, or it was rejected
+	APIStatusRateLimited     = "rate_limited"
+	APIStatusOffline         = "offline" // The API could not be reached
+	APIStatusError           = "error"   // Unexpected response
+)
+
+// APIStatusLabel returns a short indicator for a usage API problem, with the
+// age of the figures still shown, or "" when the API figures are current
+func APIStatusLabel(status string, age time.Duration) string {
+	label := map[string]string{
+		APIStatusStale:           "stale",
+		APIStatusUnauthenticated: "no auth",
+		APIStatusRateLimited:     "rate limited",
+		APIStatusOffline:         "offline",
+		APIStatusError:           "api error",
+	}[status]
+	if label == "" {
+		return ""
+	}
+	if age >= 24*time.Hour {
+		return fmt.Sprintf("%s %dd", label, int(age.Hours()/24))
+	}
+	if age >= time.Minute {
+		return label + " " + FormatDuration(age)
+	}
+	return label
+}
+
+// Budget warning levels
+const (
+	BudgetOK   = iota
+	BudgetWarn // A warning threshold was crossed
+	BudgetOver // A budget was used up
+)
+
 // Theme interface definition
 type Theme interface {
 	Name() string
@@ -101,6 +224,57 @@ type Theme interface {
 	Render(data StatusData) string
 }
 
+// APIExtrasRenderer is implemented by themes that show the API status, the
+// Opus weekly limit and the limit forecasts in their own layout
+type APIExtrasRenderer interface {
+	RendersAPIExtras()
+}
+
+// Render renders data with a theme. When data.ShowAPIExtras is set, themes
+// that do not show the API status, the Opus weekly limit and the limit
+// forecasts themselves get them on an extra line, only when there is
+// something to show.
+func Render(theme Theme, data StatusData) string {
+	out := theme.Render(data)
+	if _, ok := theme.(APIExtrasRenderer); ok || !data.ShowAPIExtras {
+		return out
+	}
+	if extras := APIExtrasLine(data); extras != "" {
+		if out != "" && !strings.HasSuffix(out, "\n") {
+			out += "\n"
+		}
+		out += extras + "\n"
+	}
+	return out
+}
+
+// APIExtrasLine formats the API status, the limit forecasts and the Opus
+// weekly limit as one line, or returns "" when none of them apply
+func APIExtrasLine(data StatusData) string {
+	var parts []string
+	if status := APIStatusLabel(data.APIStatus, data.APICacheAge); status != "" {
+		parts = append(parts, fmt.Sprintf("%s⚠ %s%s", ColorNeonOrange, status, Reset))
+	}
+	if data.API5hrProjectedExhaust != "" {
+		parts = append(parts, fmt.Sprintf("%s5hr%s %s→100%% %s%s", ColorLabelDim, Reset, ColorNeonOrange, data.API5hrProjectedExhaust, Reset))
+	}
+	if data.API7dayProjectedExhaust != "" {
+		parts = append(parts, fmt.Sprintf("%s7dy%s %s→100%% %s%s", ColorLabelDim, Reset, ColorNeonOrange, data.API7dayProjectedExhaust, Reset))
+	}
+	if opus, ok := data.APILimits[LimitSevenDayOpus]; ok {
+		color, _ := GetBarColor(opus.Percent)
+		part := fmt.Sprintf("%sopus%s %s%d%%%s", ColorLabelDim, Reset, color, opus.Percent, Reset)
+		if opus.Exhaust != "" {
+			part += fmt.Sprintf(" %s→100%% %s%s", ColorNeonOrange, opus.Exhaust, Reset)
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" %sAPI%s %s", ColorDim, Reset, strings.Join(parts, fmt.Sprintf(" %s·%s ", ColorDim, Reset)))
+}
+
 // ThemeRegistry stores all registered themes
 var ThemeRegistry = make(map[string]Theme)
 
@@ -164,6 +338,25 @@ func FormatCostShort(cost float64) string {
 	return fmt.Sprintf("$%.2f", cost)
 }
 
+// FormatModelCosts formats a per-model cost breakdown, e.g. "Opus $3.10 / Sonnet $0.40"
+func FormatModelCosts(costs []ModelCost) string {
+	parts := make([]string, 0, len(costs))
+	for _, c := range costs {
+		parts = append(parts, c.Model+" "+FormatCost(c.Cost))
+	}
+	return strings.Join(parts, " / ")
+}
+
+// FormatDuration formats a duration in short form, e.g. "1h05m", "12m", "45s"
+func FormatDuration(d time.Duration) string {
+	if d >= time.Hour {
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	} else if d >= time.Minute {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%ds", int(d.Seconds()))
+}
+
 // FormatPercent formats percentage
 func FormatPercent(pct int) string {
 	return fmt.Sprintf("%d%%", pct)
@@ -3,6 +3,7 @@ package themes
 import (
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestFormatTokens(t *testing.T) {
@@ -58,6 +59,87 @@ func TestFormatCost(t *testing.T) {
 	}
 }
 
+func TestFormatModelCosts(t *testing.T) {
+	tests := []struct {
+		name     string
+		costs    []ModelCost
+		expected string
+	}{
+		{"empty", nil, ""},
+		{"single", []ModelCost{{"Opus", 3.1}}, "Opus $3.10"},
+		{"mixed", []ModelCost{{"Opus", 3.1}, {"Sonnet", 0.4}}, "Opus $3.10 / Sonnet $0.40"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := FormatModelCosts(tt.costs)
+			if result != tt.expected {
+				t.Errorf("FormatModelCosts(%v) = %q, want %q", tt.costs, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d        time.Duration
+		expected string
+	}{
+		{0, "0s"},
+		{45 * time.Second, "45s"},
+		{12 * time.Minute, "12m"},
+		{65 * time.Minute, "1h05m"},
+		{26 * time.Hour, "26h00m"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			result := FormatDuration(tt.d)
+			if result != tt.expected {
+				t.Errorf("FormatDuration(%v) = %q, want %q", tt.d, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBudgetUsageLabel(t *testing.T) {
+	tests := []struct {
+		budget   BudgetUsage
+		expected string
+	}{
+		{BudgetUsage{Period: "day"}, "day"},
+		{BudgetUsage{Period: "week"}, "wk"},
+		{BudgetUsage{Period: "month", Project: "/repo"}, "prj mon"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.budget.Label(); got != tt.expected {
+			t.Errorf("Label(%+v) = %q, want %q", tt.budget, got, tt.expected)
+		}
+	}
+}
+
+func TestAPIStatusLabel(t *testing.T) {
+	tests := []struct {
+		status   string
+		age      time.Duration
+		expected string
+	}{
+		{"", 0, ""},
+		{APIStatusOK, 3 * time.Minute, ""},
+		{APIStatusOffline, 25 * time.Minute, "offline 25m"},
+		{APIStatusStale, 3 * time.Hour, "stale 3h00m"},
+		{APIStatusUnauthenticated, 0, "no auth"},
+		{APIStatusRateLimited, 50 * time.Hour, "rate limited 2d"},
+	}
+
+	for _, tt := range tests {
+		if got := APIStatusLabel(tt.status, tt.age); got != tt.expected {
+			t.Errorf("APIStatusLabel(%q, %v) = %q, want %q", tt.status, tt.age, got, tt.expected)
+		}
+	}
+}
+
 func TestVisibleWidth(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -268,3 +350,23 @@ func TestGetContextColor(t *testing.T) {
 		})
 	}
 }
+
+func TestRenderAPIExtras(t *testing.T) {
+	classic, _ := GetTheme("classic")
+	minimal, _ := GetTheme("minimal")
+	offline := StatusData{APIStatus: APIStatusOffline, APICacheAge: 25 * time.Minute}
+
+	if got, plain := Render(classic, offline), classic.Render(offline); got != plain {
+		t.Errorf("Render() added a line without ShowAPIExtras:\n%s", got)
+	}
+	offline.ShowAPIExtras = true
+	if got, plain := Render(classic, StatusData{ShowAPIExtras: true}), classic.Render(StatusData{}); got != plain {
+		t.Errorf("Render() added output with nothing to show:\n%s", got)
+	}
+	if got := Render(classic, offline); !strings.Contains(got, "⚠ offline 25m") || !strings.HasSuffix(got, "\n") {
+		t.Errorf("Render(classic) = %q, want the offline indicator on an extra line", got)
+	}
+	if got, plain := Render(minimal, offline), minimal.Render(offline); got != plain {
+		t.Errorf("Render(minimal) added a line although the theme shows the status itself")
+	}
+}
@@ -16,6 +16,9 @@ func (t *TwolinePillsTheme) Name() string {
 	return "twoline_pills"
 }
 
+// RendersAPIExtras marks that the theme shows the API status, Opus limit and forecasts itself
+func (t *TwolinePillsTheme) RendersAPIExtras() {}
+
 func (t *TwolinePillsTheme) Description() string {
 	return "Two-line pills: line 1 identity + workspace, line 2 API limits + session stats"
 }
@@ -47,6 +50,21 @@ func (t *TwolinePillsTheme) Render(data StatusData) string {
 		sb.WriteString(t.pill(gitContent, PillBorder))
 	}
 
+	// Code churn and time spent waiting on the model
+	if data.LinesAdded > 0 || data.LinesRemoved > 0 {
+		sb.WriteString(" ")
+		churn := fmt.Sprintf("%s+%d%s %s-%d%s",
+			ColorGreen, data.LinesAdded, Reset,
+			ColorRed, data.LinesRemoved, Reset)
+		if data.LinesPerDollar > 0 {
+			churn += fmt.Sprintf(" %s·%s %s%.0f%s%s/$%s", ColorDim, Reset, ColorYellow, data.LinesPerDollar, Reset, ColorDim, Reset)
+		}
+		if data.WallTime > 0 {
+			churn += fmt.Sprintf(" %s·%s %sapi%s %s%d%%%s", ColorDim, Reset, ColorDim, Reset, ColorCyan, data.APITimePercent, Reset)
+		}
+		sb.WriteString(t.pill(churn, PillBorder))
+	}
+
 	sb.WriteString("\n")
 
 	// ── Line 2: 5hr | 7day | Ctx | Session cost ──
@@ -58,6 +76,12 @@ func (t *TwolinePillsTheme) Render(data StatusData) string {
 	if data.API5hrTimeLeft != "" {
 		time5 = fmt.Sprintf(" %s%s%s", ColorDim, data.API5hrTimeLeft, Reset)
 	}
+	if data.API5hrProjectedExhaust != "" {
+		time5 += fmt.Sprintf(" %s→100%% %s%s", ColorNeonOrange, data.API5hrProjectedExhaust, Reset)
+	}
+	if status := APIStatusLabel(data.APIStatus, data.APICacheAge); status != "" {
+		time5 += fmt.Sprintf(" %s⚠ %s%s", ColorNeonOrange, status, Reset)
+	}
 	sb.WriteString(t.pill(
 		fmt.Sprintf("%s5h%s %s %s%d%%%s%s", ColorDim, Reset, bar5, color5, data.API5hrPercent, Reset, time5),
 		PillBorder))
@@ -71,12 +95,28 @@ func (t *TwolinePillsTheme) Render(data StatusData) string {
 	if data.API7dayTimeLeft != "" {
 		time7 = fmt.Sprintf(" %s%s%s", ColorDim, data.API7dayTimeLeft, Reset)
 	}
+	if data.API7dayProjectedExhaust != "" {
+		time7 += fmt.Sprintf(" %s→100%% %s%s", ColorNeonOrange, data.API7dayProjectedExhaust, Reset)
+	}
 	sb.WriteString(t.pill(
 		fmt.Sprintf("%s7d%s %s %s%d%%%s%s", ColorDim, Reset, bar7, color7, data.API7dayPercent, Reset, time7),
 		PillBorder))
 
 	sb.WriteString(" ")
 
+	// 7day Opus
+	if opus, ok := data.APILimits[LimitSevenDayOpus]; ok {
+		colorOpus, _ := GetBarColor(opus.Percent)
+		exhaustOpus := ""
+		if opus.Exhaust != "" {
+			exhaustOpus = fmt.Sprintf(" %s→100%% %s%s", ColorNeonOrange, opus.Exhaust, Reset)
+		}
+		sb.WriteString(t.pill(
+			fmt.Sprintf("%sopus%s %s %s%d%%%s%s", ColorDim, Reset, t.miniBar(opus.Percent, 6, colorOpus), colorOpus, opus.Percent, Reset, exhaustOpus),
+			PillBorder))
+		sb.WriteString(" ")
+	}
+
 	// Context
 	ctxColor := GetContextColor(data.ContextPercent)
 	ctxBar := t.miniBar(data.ContextPercent, 6, ctxColor)
@@ -94,6 +134,31 @@ func (t *TwolinePillsTheme) Render(data StatusData) string {
 			ColorYellow, FormatCostShort(data.DayCost), Reset, ColorDim, Reset),
 		PillBorder))
 
+	// Budgets
+	if len(data.Budgets) > 0 {
+		parts := make([]string, 0, len(data.Budgets))
+		for _, budget := range data.Budgets {
+			color, _ := GetBarColor(budget.Percent)
+			parts = append(parts, fmt.Sprintf("%s%s%s %s %s%d%%%s",
+				ColorDim, budget.Label(), Reset,
+				t.miniBar(budget.Percent, 4, color),
+				color, budget.Percent, Reset))
+		}
+		sb.WriteString(" ")
+		sb.WriteString(t.pill(strings.Join(parts, fmt.Sprintf(" %s·%s ", ColorDim, Reset)), PillBorder))
+	}
+
+	// Current project's spend this week
+	if data.ProjectWeekCost > 0 {
+		sb.WriteString(" ")
+		sb.WriteString(t.pill(
+			fmt.Sprintf("%sprj%s %s%s%s %swk%s %s%s%s",
+				ColorDim, Reset,
+				ColorBlue, FormatCostShort(data.ProjectWeekCost), Reset, ColorDim, Reset,
+				ColorSilver, FormatDuration(data.ProjectWeekTime), Reset),
+			PillBorder))
+	}
+
 	sb.WriteString("\n")
 
 	return sb.String()
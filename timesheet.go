@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimesheetEntry is one stretch of work on a project, merged from session intervals
+type TimesheetEntry struct {
+	Project  string
+	Start    int64
+	End      int64
+	Sessions []string
+}
+
+// runTimesheet handles the timesheet subcommand
+func runTimesheet(args []string) {
+	config := loadConfig()
+	applyConfig(config)
+
+	flags := flag.NewFlagSet("timesheet", flag.ExitOnError)
+	format := flags.String("format", "csv", "Output format: csv or ics")
+	since := flags.String("since", "", "First day to include (YYYY-MM-DD)")
+	until := flags.String("until", "", "Last day to include (YYYY-MM-DD)")
+	project := flags.String("project", "", "Only include this project (path or directory name)")
+	mergeGap := flags.Duration("merge-gap", time.Duration(config.TimesheetMergeGap)*time.Second, "Merge intervals of a project less than this far apart")
+	flags.Parse(args)
+
+	for _, date := range []string{*since, *until} {
+		if _, err := dayKeyStart(date); date != "" && err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid date %q, expected YYYY-MM-DD\n", date)
+			os.Exit(1)
+		}
+	}
+
+	if warning := timesheetRangeWarning(*since, config.retentionDays(), time.Now()); warning != "" {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+
+	entries := buildTimesheet(loadSessions(), *project, *since, *until, int64(mergeGap.Seconds()))
+	switch *format {
+	case "csv":
+		writeTimesheetCSV(os.Stdout, entries)
+	case "ics":
+		writeTimesheetICS(os.Stdout, entries, time.Now())
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown --format %q, expected csv or ics\n", *format)
+		os.Exit(1)
+	}
+}
+
+// timesheetRangeWarning warns when the timesheet range reaches back before the
+// retention cutoff, where sessions were pruned to daily totals without
+// intervals. Without --since it only warns once sessions have been pruned.
+func timesheetRangeWarning(since string, retentionDays int, now time.Time) string {
+	cutoff := dayKey(now.AddDate(0, 0, -retentionDays))
+	if since == "" {
+		if summaries, _ := filepath.Glob(summaryPath("*")); len(summaries) == 0 {
+			return ""
+		}
+	} else if since >= cutoff {
+		return ""
+	}
+	return fmt.Sprintf("Warning: session intervals are only kept for %d days (retention_days); the timesheet has no entries before %s",
+		retentionDays, cutoff)
+}
+
+// buildTimesheet collects the closed intervals of the sessions that started on
+// stats days in [since, until], both inclusive and optional, and merges each
+// project's intervals that overlap or are at most mergeGap seconds apart.
+// Parallel sessions on one project therefore count once.
+func buildTimesheet(sessions []Session, project, since, until string, mergeGap int64) []TimesheetEntry {
+	byProject := make(map[string][]TimesheetEntry)
+	for _, session := range sessions {
+		name := session.Project
+		if name == "" {
+			name = "(unknown)"
+		}
+		if project != "" && name != project && filepath.Base(name) != project {
+			continue
+		}
+		for _, interval := range session.Intervals {
+			if interval.End == nil || *interval.End <= interval.Start {
+				continue
+			}
+			day := dayKey(time.Unix(interval.Start, 0))
+			if (since != "" && day < since) || (until != "" && day > until) {
+				continue
+			}
+			byProject[name] = append(byProject[name], TimesheetEntry{
+				Project:  name,
+				Start:    interval.Start,
+				End:      *interval.End,
+				Sessions: []string{session.ID},
+			})
+		}
+	}
+
+	var entries []TimesheetEntry
+	for _, intervals := range byProject {
+		sort.Slice(intervals, func(i, j int) bool { return intervals[i].Start < intervals[j].Start })
+		for _, interval := range intervals {
+			if n := len(entries); n > 0 && entries[n-1].Project == interval.Project && interval.Start-entries[n-1].End <= mergeGap {
+				last := &entries[n-1]
+				last.End = max(last.End, interval.End)
+				if !containsString(last.Sessions, interval.Sessions[0]) {
+					last.Sessions = append(last.Sessions, interval.Sessions[0])
+				}
+				continue
+			}
+			entries = append(entries, interval)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Start != entries[j].Start {
+			return entries[i].Start < entries[j].Start
+		}
+		return entries[i].Project < entries[j].Project
+	})
+	return entries
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// writeTimesheetCSV writes timesheet entries as CSV, with times in the stats timezone
+func writeTimesheetCSV(w io.Writer, entries []TimesheetEntry) {
+	out := csv.NewWriter(w)
+	out.Write([]string{"project", "date", "start", "end", "hours", "sessions"})
+	for _, entry := range entries {
+		start := time.Unix(entry.Start, 0).In(statsLocation)
+		end := time.Unix(entry.End, 0).In(statsLocation)
+		out.Write([]string{
+			entry.Project,
+			dayKey(start),
+			start.Format(time.RFC3339),
+			end.Format(time.RFC3339),
+			strconv.FormatFloat(float64(entry.End-entry.Start)/3600, 'f', 2, 64),
+			strings.Join(entry.Sessions, " "),
+		})
+	}
+	out.Flush()
+}
+
+// writeTimesheetICS writes timesheet entries as an iCalendar file with one event
+// per entry. Event UIDs are derived from the project and start time, so
+// re-importing an export updates the events instead of duplicating them.
+func writeTimesheetICS(w io.Writer, entries []TimesheetEntry, now time.Time) {
+	const stampFormat = "20060102T150405Z"
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//claude-statusline//timesheet//EN",
+		"CALSCALE:GREGORIAN",
+	}
+	for _, entry := range entries {
+		hash := fnv.New64a()
+		fmt.Fprintf(hash, "%s|%d", entry.Project, entry.Start)
+
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:%x@claude-statusline", hash.Sum64()),
+			"DTSTAMP:"+now.UTC().Format(stampFormat),
+			"DTSTART:"+time.Unix(entry.Start, 0).UTC().Format(stampFormat),
+			"DTEND:"+time.Unix(entry.End, 0).UTC().Format(stampFormat),
+			"SUMMARY:"+icsEscape("Claude: "+filepath.Base(entry.Project)),
+			"DESCRIPTION:"+icsEscape(fmt.Sprintf("Project: %s\nSessions: %s", entry.Project, strings.Join(entry.Sessions, ", "))),
+			"END:VEVENT",
+		)
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		io.WriteString(w, icsFold(line)+"\r\n")
+	}
+}
+
+// icsEscape escapes an iCalendar TEXT value
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// icsFold splits a content line into lines of at most 75 octets, without breaking UTF-8 sequences
+func icsFold(line string) string {
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TranscriptCursor records how far a session transcript has been parsed and the
+// running totals up to that point, so later renders only read newly appended lines.
+type TranscriptCursor struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+	Inode  uint64 `json:"inode"`
+	Size   int64  `json:"size"`
+
+	// Pricing fingerprints the price tables the running cost was computed with
+	Pricing string `json:"pricing"`
+
+	InputTokens        int64     `json:"input_tokens"`
+	OutputTokens       int64     `json:"output_tokens"`
+	CacheReadTokens    int64     `json:"cache_read_tokens"`
+	CacheWriteTokens   int64     `json:"cache_write_tokens"`
+	CacheWrite1hTokens int64     `json:"cache_write_1h_tokens"`
+	Cost               float64   `json:"cost"`
+	MessageCount       int       `json:"message_count"`
+	SessionStart       time.Time `json:"session_start"`
+	LastTime           time.Time `json:"last_time"`
+	LastPromptTokens   int64     `json:"last_prompt_tokens"`
+
+	Models map[string]ModelUsage `json:"models,omitempty"`
+
+	Subagents      ModelUsage            `json:"subagents"`
+	SubagentModels map[string]ModelUsage `json:"subagent_models,omitempty"`
+	SubagentCount  int                   `json:"subagent_count"`
+
+	// Activity is the session's active intervals from transcript timestamps,
+	// split at pauses of IdleGap seconds
+	Activity []Interval `json:"activity,omitempty"`
+	IdleGap  int64      `json:"idle_gap"`
+
+	// RecentKeys holds the dedup keys of the latest API responses
+	RecentKeys dedupWindow `json:"recent_keys,omitempty"`
+}
+
+// maxRecentKeys bounds the dedup window. Lines belonging to one API response are
+// written back to back, so a short window is enough and keeps the cursor file small.
+const maxRecentKeys = 256
+
+// dedupWindow holds the dedup keys of the latest maxRecentKeys API responses,
+// oldest first. Live renders and --rebuild-stats share it so both count the
+// same responses.
+type dedupWindow []string
+
+// transcriptCursorPath returns the cursor file path for a session.
+func transcriptCursorPath(sessionID string) string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".claude", "session-tracker", "cursors", sessionID+".json")
+}
+
+// loadTranscriptCursor loads the saved cursor for a session.
+// A missing or unreadable cursor yields an empty one, which means a full scan.
+func loadTranscriptCursor(sessionID string) TranscriptCursor {
+	var cursor TranscriptCursor
+	if data, err := os.ReadFile(transcriptCursorPath(sessionID)); err == nil {
+		if err := json.Unmarshal(data, &cursor); err != nil {
+			return TranscriptCursor{}
+		}
+	}
+	return cursor
+}
+
+// saveTranscriptCursor persists the cursor for a session.
+func saveTranscriptCursor(sessionID string, cursor TranscriptCursor) {
+	cursorPath := transcriptCursorPath(sessionID)
+	if data, err := json.Marshal(cursor); err == nil {
+		writeFileAtomic(cursorPath, data, 0644)
+	}
+}
+
+// resumable reports whether parsing can continue from the cursor's offset.
+// It returns false when the transcript was replaced (different path or inode)
+// or truncated (shorter than the offset, or the offset no longer sits on a line boundary).
+func (c *TranscriptCursor) resumable(path string, file *os.File, info os.FileInfo) bool {
+	if c.Offset <= 0 || c.Path != path {
+		return false
+	}
+	if c.Inode != fileInode(info) || info.Size() < c.Offset {
+		return false
+	}
+
+	// The byte before the offset is always the newline that ended the last parsed line
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, c.Offset-1); err != nil && err != io.EOF {
+		return false
+	}
+	return last[0] == '\n'
+}
+
+// seen reports whether the API response identified by messageID and requestID has
+// already been counted, and records it otherwise. Claude Code writes one transcript
+// line per content block, each carrying the same usage, so only the first is counted.
+func (c *TranscriptCursor) seen(messageID, requestID string) bool {
+	return c.RecentKeys.seen(messageID, requestID)
+}
+
+// seen reports whether the window holds the response's key, and adds it otherwise
+func (w *dedupWindow) seen(messageID, requestID string) bool {
+	if messageID == "" && requestID == "" {
+		return false
+	}
+
+	key := messageID + ":" + requestID
+	for _, k := range *w {
+		if k == key {
+			return true
+		}
+	}
+
+	*w = append(*w, key)
+	if len(*w) > maxRecentKeys {
+		*w = (*w)[len(*w)-maxRecentKeys:]
+	}
+	return false
+}
+
+// result converts the running totals into a SessionUsageResult.
+func (c *TranscriptCursor) result() SessionUsageResult {
+	result := SessionUsageResult{
+		InputTokens:        c.InputTokens,
+		OutputTokens:       c.OutputTokens,
+		CacheReadTokens:    c.CacheReadTokens,
+		CacheWriteTokens:   c.CacheWriteTokens,
+		CacheWrite1hTokens: c.CacheWrite1hTokens,
+		Cost:               c.Cost,
+		MessageCount:       c.MessageCount,
+		Models:             c.Models,
+		LastPromptTokens:   c.LastPromptTokens,
+		Subagents:          c.Subagents,
+		SubagentModels:     c.SubagentModels,
+		SubagentCount:      c.SubagentCount,
+		Activity:           c.Activity,
+	}
+	if !c.SessionStart.IsZero() && !c.LastTime.IsZero() {
+		result.Duration = c.LastTime.Sub(c.SessionStart)
+	}
+	return result
+}